@@ -0,0 +1,391 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/iryzzh/practicum-go-shortener/cmd/shortener/config"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/shortcode"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/boltstore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/filestore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/memstore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/sqlitestore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/sqlstore"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// run executes a subcommand given after the flags, e.g. `shortener -f urls.txt compact`.
+func run(cfg *config.Config, cmd string, args []string) error {
+	switch cmd {
+	case "compact":
+		return compact(cfg)
+	case "repair":
+		return repair(cfg)
+	case "migrate":
+		return migrate(cfg, args)
+	case "copy":
+		return copyStore(cfg, args)
+	default:
+		return fmt.Errorf("unknown command: %s", cmd)
+	}
+}
+
+func compact(cfg *config.Config) error {
+	if cfg.FileStoragePath == "" {
+		return errors.New("compact: file storage path is not set")
+	}
+
+	opts, err := newOptions(cfg)
+	if err != nil {
+		return err
+	}
+	s, err := newFileStore(cfg, opts)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	return s.Compact()
+}
+
+// repair drops corrupted records from the file storage.
+func repair(cfg *config.Config) error {
+	if cfg.FileStoragePath == "" {
+		return errors.New("repair: file storage path is not set")
+	}
+
+	opts, err := newOptions(cfg)
+	if err != nil {
+		return err
+	}
+	s, err := newFileStore(cfg, opts, filestore.WithRepair())
+	if err != nil {
+		return err
+	}
+
+	return s.Close()
+}
+
+// migrate manages the database schema: `shortener -d <dsn> migrate up|down [N]|status|force <version>`.
+func migrate(cfg *config.Config, args []string) error {
+	if cfg.DatabaseDSN == "" {
+		return errors.New("migrate: database dsn is not set")
+	}
+	if len(args) == 0 {
+		return errors.New("migrate: expected up, down, status or force")
+	}
+
+	opts, err := newOptions(cfg)
+	if err != nil {
+		return err
+	}
+	s, err := newDatabaseStore(cfg, opts, cfg.DatabaseDSN, false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		return s.MigrateUp(ctx)
+	case "down":
+		steps := 0
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil {
+				return fmt.Errorf("migrate down: invalid number of steps: %s", args[1])
+			}
+		}
+		return s.MigrateDown(ctx, steps)
+	case "status":
+		version, dirty, err := s.MigrationVersion(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version: %d, dirty: %t\n", version, dirty)
+		return nil
+	case "force":
+		if len(args) < 2 {
+			return errors.New("migrate force: version is required")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("migrate force: invalid version: %s", args[1])
+		}
+		return s.MigrateForce(ctx, version)
+	default:
+		return fmt.Errorf("migrate: unknown command: %s", args[0])
+	}
+}
+
+// copyStore moves all data between two stores:
+// `shortener copy --from <store> --to <store>`, where a store is
+// file:<path>, bolt:<path>, sqlite://<path> or a PostgreSQL DSN. Running it
+// again only brings the destination up to date.
+func copyStore(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("copy", flag.ContinueOnError)
+	from := fs.String("from", "", "source store")
+	to := fs.String("to", "", "destination store")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" {
+		return errors.New("copy: --from and --to are required")
+	}
+
+	src, err := openStore(cfg, *from, true)
+	if err != nil {
+		return fmt.Errorf("copy: open source: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := openStore(cfg, *to, false)
+	if err != nil {
+		return fmt.Errorf("copy: open destination: %w", err)
+	}
+	defer dst.Close()
+
+	ctx := context.Background()
+	progress := func(kind string, n int) {
+		log.Printf("copy: %d %s", n, kind)
+	}
+
+	if err := store.Copy(ctx, dst, src, progress); err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+
+	log.Println("copy: verifying")
+	mismatches, err := store.Verify(ctx, dst, src, 10)
+	if err != nil {
+		return fmt.Errorf("copy: verify: %w", err)
+	}
+	for _, m := range mismatches {
+		log.Println("copy:", m)
+	}
+	if len(mismatches) > 0 {
+		return errors.New("copy: destination does not match the source")
+	}
+
+	log.Println("copy: done")
+
+	return nil
+}
+
+// openStore opens a store given as file:<path>, bolt:<path>, sqlite://<path>
+// or a PostgreSQL DSN. A source is opened without changing it.
+func openStore(cfg *config.Config, spec string, source bool) (store.Store, error) {
+	opts, err := newOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(spec, "file:") {
+		path := strings.TrimPrefix(strings.TrimPrefix(spec, "file:"), "//")
+		if source {
+			return filestore.New(path, filestore.WithReadOnly(0), filestore.WithOptions(opts))
+		}
+
+		c := *cfg
+		c.FileStoragePath = path
+		c.FileReadOnly = false
+
+		return newFileStore(&c, opts)
+	}
+
+	if strings.HasPrefix(spec, "bolt:") {
+		c := *cfg
+		c.BoltStoragePath = strings.TrimPrefix(strings.TrimPrefix(spec, "bolt:"), "//")
+
+		return newBoltStore(&c, opts)
+	}
+
+	return newDatabaseStore(cfg, opts, spec, !source)
+}
+
+// databaseStore is a store with a versioned schema.
+type databaseStore interface {
+	store.Store
+	MigrateUp(ctx context.Context) error
+	MigrateDown(ctx context.Context, steps int) error
+	MigrationVersion(ctx context.Context) (uint, bool, error)
+	MigrateForce(ctx context.Context, version int) error
+}
+
+// newDatabaseStore opens SQLite for sqlite:// and sqlite3:// DSNs and
+// PostgreSQL otherwise.
+func newDatabaseStore(cfg *config.Config, opts store.Options, dsn string, autoMigrate bool) (databaseStore, error) {
+	for _, scheme := range []string{"sqlite://", "sqlite3://"} {
+		if strings.HasPrefix(dsn, scheme) {
+			s, err := sqlitestore.New(
+				strings.TrimPrefix(dsn, scheme),
+				sqlitestore.WithAutoMigrate(autoMigrate),
+				sqlitestore.WithOptions(opts),
+			)
+			if err != nil {
+				return nil, err
+			}
+			return s, nil
+		}
+	}
+
+	s, err := sqlstore.New(
+		dsn,
+		sqlstore.WithAutoMigrate(autoMigrate),
+		sqlstore.WithOptions(opts),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func newFileStore(cfg *config.Config, options store.Options, extra ...filestore.Option) (*filestore.Store, error) {
+	syncMode, err := filestore.ParseSyncMode(cfg.FileSyncMode)
+	if err != nil {
+		return nil, err
+	}
+	opts := []filestore.Option{
+		filestore.WithCompactThreshold(cfg.FileCompactThreshold),
+		filestore.WithSync(syncMode, cfg.FileSyncInterval),
+		filestore.WithOptions(options),
+	}
+	if cfg.FileCompactOnStartup {
+		opts = append(opts, filestore.WithCompactOnStartup())
+	}
+	if cfg.FileRepair {
+		opts = append(opts, filestore.WithRepair())
+	}
+	if cfg.FileReadOnly {
+		opts = append(opts, filestore.WithReadOnly(cfg.FileRefreshInterval))
+	}
+
+	return filestore.New(cfg.FileStoragePath, append(opts, extra...)...)
+}
+
+func newBoltStore(cfg *config.Config, opts store.Options) (*boltstore.Store, error) {
+	return boltstore.New(cfg.BoltStoragePath, boltstore.WithOptions(opts))
+}
+
+// newMemStore keeps everything in memory, for when no storage is configured.
+func newMemStore(opts store.Options) *memstore.Store {
+	return memstore.New(memstore.WithOptions(opts))
+}
+
+// newOptions is the configured dedup scope, generator and case of the codes
+// and the longest original URL.
+func newOptions(cfg *config.Config) (store.Options, error) {
+	dedup, err := store.ParseDedup(cfg.DedupScope)
+	if err != nil {
+		return store.Options{}, err
+	}
+	gen, err := newGenerator(cfg)
+	if err != nil {
+		return store.Options{}, err
+	}
+
+	// zero takes any length in the config and the default in the options
+	maxURLLength := cfg.MaxURLLength
+	if maxURLLength == 0 {
+		maxURLLength = -1
+	}
+
+	return store.Options{
+		Dedup:        dedup,
+		Generator:    gen,
+		Case:         store.ParseCase(cfg.ShortCodeIgnoreCase),
+		MaxURLLength: maxURLLength,
+	}, nil
+}
+
+// seedLength starts growing codes at the length the urls of s call for. The
+// last url ID stands for their number, purged urls count as well.
+func seedLength(ctx context.Context, cfg *config.Config, gen shortcode.Generator, s store.Store) error {
+	growing, ok := gen.(*shortcode.Growing)
+	if !ok {
+		return nil
+	}
+	seq, ok := s.(store.URLSequence)
+	if !ok {
+		return nil
+	}
+
+	count, err := seq.LastURLID(ctx)
+	if err != nil {
+		return err
+	}
+	alphabet, err := newAlphabet(cfg)
+	if err != nil {
+		return err
+	}
+	growing.Seed(count, alphabet)
+
+	return nil
+}
+
+// newGenerator makes the short codes of the configured kind and alphabet,
+// starting at the configured length and growing once more than
+// ShortCodeGrowRate of them collide. The rate is zero unless it is set,
+// which keeps the length. The codes which spell a word of the blocklist
+// file, or of the built-in list when none is configured, are replaced. With
+// ShortCodeCheck they end with a check character.
+func newGenerator(cfg *config.Config) (shortcode.Generator, error) {
+	alphabet, err := newAlphabet(cfg)
+	if err != nil {
+		return nil, err
+	}
+	blocklist, err := newBlocklist(cfg)
+	if err != nil {
+		return nil, err
+	}
+	factory, err := shortcode.Factory(cfg.ShortCodeGenerator, alphabet, cfg.ShortCodeSalt)
+	if err != nil {
+		return nil, err
+	}
+	newGen := func(length int) shortcode.Generator {
+		gen := factory(length)
+		if cfg.ShortCodeCheck {
+			gen = shortcode.NewChecked(gen, alphabet)
+		}
+		return shortcode.NewFiltered(gen, blocklist)
+	}
+	if cfg.ShortCodeGrowRate <= 0 || cfg.ShortCodeGrowWindow <= 0 {
+		return newGen(cfg.URLLen), nil
+	}
+
+	return shortcode.NewGrowing(newGen, cfg.URLLen, cfg.ShortCodeGrowRate, cfg.ShortCodeGrowWindow), nil
+}
+
+// newAlphabet is the configured alphabet. The check character of a code
+// which is stored in lower case only holds for a lower case alphabet.
+func newAlphabet(cfg *config.Config) (shortcode.Alphabet, error) {
+	alphabet, err := shortcode.ParseAlphabet(cfg.ShortCodeAlphabet)
+	if err != nil {
+		return "", err
+	}
+	if cfg.ShortCodeCheck && cfg.ShortCodeIgnoreCase && strings.ToLower(string(alphabet)) != string(alphabet) {
+		return "", fmt.Errorf("short code check needs a lower case alphabet to ignore case, not %s", cfg.ShortCodeAlphabet)
+	}
+
+	return alphabet, nil
+}
+
+func newBlocklist(cfg *config.Config) (shortcode.Blocklist, error) {
+	if cfg.ShortCodeBlocklist == "" {
+		return shortcode.DefaultBlocklist(), nil
+	}
+
+	file, err := os.Open(cfg.ShortCodeBlocklist)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return shortcode.ReadBlocklist(file)
+}
@@ -4,16 +4,42 @@ import (
 	"flag"
 	"github.com/caarlos0/env/v6"
 	"sync"
+	"time"
 )
 
 type Config struct {
-	Network         string `env:"NETWORK" envDefault:"tcp"`
-	BindAddress     string `env:"SERVER_ADDRESS" envDefault:"localhost:8080"`
-	BaseURL         string `env:"BASE_URL" envDefault:"http://localhost:8080"`
-	URLLen          int    `env:"LINK_LEN" envDefault:"8"`
-	FileStoragePath string `env:"FILE_STORAGE_PATH"`
-	DatabaseDSN     string `env:"DATABASE_DSN"`
-	SessionKey      string `env:"SESSION_KEY" envDefault:"secret-key"`
+	Network              string        `env:"NETWORK" envDefault:"tcp"`
+	BindAddress          string        `env:"SERVER_ADDRESS" envDefault:"localhost:8080"`
+	BaseURL              string        `env:"BASE_URL" envDefault:"http://localhost:8080"`
+	URLLen               int           `env:"LINK_LEN" envDefault:"8"`
+	ShortCodeGenerator   string        `env:"SHORT_CODE_GENERATOR" envDefault:"random"`
+	ShortCodeSalt        string        `env:"SHORT_CODE_SALT"`
+	ShortCodeAlphabet    string        `env:"SHORT_CODE_ALPHABET" envDefault:"base62"`
+	ShortCodeBlocklist   string        `env:"SHORT_CODE_BLOCKLIST"`
+	ShortCodeIgnoreCase  bool          `env:"SHORT_CODE_IGNORE_CASE"`
+	ShortCodeCheck       bool          `env:"SHORT_CODE_CHECK"`
+	ShortCodeGrowRate    float64       `env:"SHORT_CODE_GROW_RATE"` // e.g. 0.01 grows the codes once 1% of a window collide, 0 keeps LINK_LEN
+	ShortCodeGrowWindow  int           `env:"SHORT_CODE_GROW_WINDOW" envDefault:"1000"`
+	MaxURLLength         int           `env:"MAX_URL_LENGTH" envDefault:"2048"`
+	FileStoragePath      string        `env:"FILE_STORAGE_PATH"`
+	FileCompactOnStartup bool          `env:"FILE_COMPACT_ON_STARTUP"`
+	FileCompactThreshold int64         `env:"FILE_COMPACT_THRESHOLD" envDefault:"67108864"`
+	FileRepair           bool          `env:"FILE_REPAIR"`
+	FileSyncMode         string        `env:"FILE_SYNC_MODE" envDefault:"never"`
+	FileSyncInterval     time.Duration `env:"FILE_SYNC_INTERVAL" envDefault:"10ms"`
+	FileReadOnly         bool          `env:"FILE_READ_ONLY"`
+	FileRefreshInterval  time.Duration `env:"FILE_REFRESH_INTERVAL" envDefault:"1s"`
+	BoltStoragePath      string        `env:"BOLT_STORAGE_PATH"`
+	DatabaseDSN          string        `env:"DATABASE_DSN"`
+	DatabaseAutoMigrate  bool          `env:"DATABASE_AUTO_MIGRATE" envDefault:"true"`
+	DedupScope           string        `env:"DEDUP_SCOPE" envDefault:"global"`
+	SweepInterval        time.Duration `env:"SWEEP_INTERVAL" envDefault:"1m"`
+	PurgeRetention       time.Duration `env:"PURGE_RETENTION"`
+	ReuseDeletedURLs     bool          `env:"REUSE_DELETED_URLS"`
+	CacheSize            int           `env:"CACHE_SIZE"`
+	CacheTTL             time.Duration `env:"CACHE_TTL" envDefault:"1m"`
+	SessionKey           string        `env:"SESSION_KEY" envDefault:"secret-key"`
+	DebugVars            bool          `env:"DEBUG_VARS"`
 }
 
 var once sync.Once
@@ -29,7 +55,8 @@ func New() (*Config, error) {
 		flag.StringVar(&cfg.BindAddress, "a", cfg.BindAddress, "bind address")
 		flag.StringVar(&cfg.BaseURL, "b", cfg.BaseURL, "base url")
 		flag.StringVar(&cfg.FileStoragePath, "f", cfg.FileStoragePath, "file storage path")
-		flag.StringVar(&cfg.DatabaseDSN, "d", cfg.DatabaseDSN, "database dsn")
+		flag.StringVar(&cfg.BoltStoragePath, "bolt", cfg.BoltStoragePath, "bolt storage path")
+		flag.StringVar(&cfg.DatabaseDSN, "d", cfg.DatabaseDSN, "database dsn, sqlite://<path> for SQLite")
 		flag.StringVar(&cfg.SessionKey, "s", cfg.SessionKey, "session key")
 
 		flag.Parse()
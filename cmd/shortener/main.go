@@ -2,14 +2,17 @@ package main
 
 import (
 	"context"
+	"expvar"
+	"flag"
 	"github.com/iryzzh/practicum-go-shortener/cmd/shortener/config"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/handlers"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/server"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/shortcode"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
-	"github.com/iryzzh/practicum-go-shortener/internal/app/store/filestore"
-	"github.com/iryzzh/practicum-go-shortener/internal/app/store/memstore"
-	"github.com/iryzzh/practicum-go-shortener/internal/app/store/sqlstore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/cachestore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/sweeper"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -27,30 +30,78 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if cmd := flag.Arg(0); cmd != "" {
+		if err := run(cfg, cmd, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	opts, err := newOptions(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	var s store.Store
 
 	switch {
 	case cfg.FileStoragePath != "":
-		s, err = filestore.New(cfg.FileStoragePath)
+		s, err = newFileStore(cfg, opts)
+	case cfg.BoltStoragePath != "":
+		s, err = newBoltStore(cfg, opts)
 	case cfg.DatabaseDSN != "":
-		s, err = sqlstore.New(cfg.DatabaseDSN)
+		s, err = newDatabaseStore(cfg, opts, cfg.DatabaseDSN, cfg.DatabaseAutoMigrate)
 	default:
-		s = memstore.New()
+		s = newMemStore(opts)
 	}
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if err := seedLength(ctx, cfg, opts.Generator, s); err != nil {
+		log.Fatal(err)
+	}
+
+	if cfg.CacheSize > 0 {
+		s = cachestore.New(
+			s,
+			cachestore.WithSize(cfg.CacheSize),
+			cachestore.WithTTL(cfg.CacheTTL),
+			cachestore.WithOptions(store.Options{Case: store.ParseCase(cfg.ShortCodeIgnoreCase)}),
+		)
+	}
+
 	defer s.Close()
 
-	handler := handlers.New(cfg.URLLen, cfg.BaseURL, s, []byte(cfg.SessionKey))
+	handler := handlers.New(cfg.BaseURL, s, []byte(cfg.SessionKey))
+	handler.ReuseDeleted = cfg.ReuseDeletedURLs
+	if cfg.ShortCodeCheck {
+		// the store has been made with it, so it is known to be valid
+		handler.CheckAlphabet, _ = newAlphabet(cfg)
+		handler.CodeLength = cfg.URLLen + 1
+		// codes grown after startup are not taken for typos until a restart
+		if growing, ok := opts.Generator.(*shortcode.Growing); ok {
+			handler.CodeLength = growing.Length() + 1
+		}
+	}
+	// expvar lists the command line as well, which may hold the dsn
+	if cfg.DebugVars {
+		handler.Method(http.MethodGet, "/debug/vars", expvar.Handler())
+	}
 	srv := server.New(cfg.Network, cfg.BindAddress, handler)
 
 	g, _ := errgroup.WithContext(ctx)
 	g.Go(func() error {
 		return srv.Serve(ctx)
 	})
+	// a read-only file store leaves the sweeping to the writer
+	if cfg.SweepInterval > 0 && !(cfg.FileStoragePath != "" && cfg.FileReadOnly) {
+		sw := sweeper.New(s, cfg.SweepInterval, sweeper.WithRetention(cfg.PurgeRetention))
+		g.Go(func() error {
+			return sw.Run(ctx)
+		})
+	}
 
 	if err := g.Wait(); err != nil {
 		log.Fatal(err)
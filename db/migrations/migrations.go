@@ -0,0 +1,15 @@
+// Package migrations embeds the SQL migrations so the binary does not depend
+// on the working directory it is started from.
+package migrations
+
+import "embed"
+
+// Postgres holds the migrations of sqlstore under the "pg" directory.
+//
+//go:embed pg/*.sql
+var Postgres embed.FS
+
+// SQLite holds the migrations of sqlitestore under the "sqlite" directory.
+//
+//go:embed sqlite/*.sql
+var SQLite embed.FS
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS urls_dedup_user_id_original_url_key;
+ALTER TABLE urls ADD CONSTRAINT urls_original_url_key UNIQUE (original_url);
+ALTER TABLE urls DROP COLUMN IF EXISTS dedup_user_id;
@@ -0,0 +1,3 @@
+ALTER TABLE urls ADD COLUMN dedup_user_id int NOT NULL DEFAULT 0;
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_original_url_key;
+CREATE UNIQUE INDEX IF NOT EXISTS urls_dedup_user_id_original_url_key ON urls (dedup_user_id, original_url);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS urls_dedup_user_id_original_url_hash_key;
+ALTER TABLE urls DROP COLUMN IF EXISTS original_url_hash;
+ALTER TABLE urls ALTER COLUMN original_url TYPE VARCHAR(255);
+CREATE UNIQUE INDEX IF NOT EXISTS urls_dedup_user_id_original_url_key ON urls (dedup_user_id, original_url);
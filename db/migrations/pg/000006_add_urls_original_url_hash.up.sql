@@ -0,0 +1,6 @@
+ALTER TABLE urls ALTER COLUMN original_url TYPE text;
+ALTER TABLE urls ADD COLUMN original_url_hash char(32);
+UPDATE urls SET original_url_hash = md5(original_url);
+ALTER TABLE urls ALTER COLUMN original_url_hash SET NOT NULL;
+DROP INDEX IF EXISTS urls_dedup_user_id_original_url_key;
+CREATE UNIQUE INDEX IF NOT EXISTS urls_dedup_user_id_original_url_hash_key ON urls (dedup_user_id, original_url_hash);
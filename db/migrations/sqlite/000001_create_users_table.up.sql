@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS users
+(
+    user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    uuid    TEXT UNIQUE NOT NULL
+);
\ No newline at end of file
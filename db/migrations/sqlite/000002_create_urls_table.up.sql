@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS urls
+(
+    url_id       INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id      INTEGER DEFAULT 0,
+    original_url TEXT UNIQUE NOT NULL,
+    short_url    TEXT UNIQUE NOT NULL,
+    is_deleted   BOOLEAN DEFAULT FALSE
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN expires_at DATETIME;
+CREATE INDEX IF NOT EXISTS urls_expires_at_idx ON urls (expires_at) WHERE expires_at IS NOT NULL AND NOT is_deleted;
\ No newline at end of file
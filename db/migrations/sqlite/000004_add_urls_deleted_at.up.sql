@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN deleted_at DATETIME;
+CREATE INDEX IF NOT EXISTS urls_deleted_at_idx ON urls (deleted_at) WHERE is_deleted;
@@ -0,0 +1,18 @@
+CREATE TABLE urls_old
+(
+    url_id       INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id      INTEGER DEFAULT 0,
+    original_url TEXT UNIQUE NOT NULL,
+    short_url    TEXT UNIQUE NOT NULL,
+    is_deleted   BOOLEAN DEFAULT FALSE,
+    expires_at   DATETIME,
+    deleted_at   DATETIME
+);
+INSERT INTO urls_old (url_id, user_id, original_url, short_url, is_deleted, expires_at, deleted_at)
+SELECT url_id, user_id, original_url, short_url, is_deleted, expires_at, deleted_at FROM urls;
+DELETE FROM sqlite_sequence WHERE name = 'urls_old';
+INSERT INTO sqlite_sequence (name, seq) SELECT 'urls_old', seq FROM sqlite_sequence WHERE name = 'urls';
+DROP TABLE urls;
+ALTER TABLE urls_old RENAME TO urls;
+CREATE INDEX IF NOT EXISTS urls_expires_at_idx ON urls (expires_at) WHERE expires_at IS NOT NULL AND NOT is_deleted;
+CREATE INDEX IF NOT EXISTS urls_deleted_at_idx ON urls (deleted_at) WHERE is_deleted;
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrIncorrectAlias = errors.New("incorrect alias")
+
+	reAlias = regexp.MustCompile(`^[a-zA-Z0-9_-]{3,32}$`)
+	// reservedAliases are the first path segments of the other routes, a
+	// link there could not be followed.
+	reservedAliases = map[string]bool{
+		"api":   true,
+		"debug": true,
+		"ping":  true,
+	}
+)
+
+// alias is the optional short code a request asks for instead of a random
+// one: 3 to 32 letters, digits, "-" or "_".
+type alias struct {
+	Alias *string `json:"alias,omitempty"`
+}
+
+// short returns the alias if there is one, otherwise an empty code, which
+// the store makes with its generator.
+func (a alias) short() (string, error) {
+	if a.Alias == nil {
+		return "", nil
+	}
+
+	if !reAlias.MatchString(*a.Alias) || reservedAliases[strings.ToLower(*a.Alias)] {
+		return "", ErrIncorrectAlias
+	}
+
+	return *a.Alias, nil
+}
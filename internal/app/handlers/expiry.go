@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+var ErrIncorrectExpiry = errors.New("incorrect expiry")
+
+// expiry is the optional lifetime of a link in a request: the time it stops
+// working or the number of seconds it works for, not both.
+type expiry struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	TTL       *int64     `json:"ttl,omitempty"`
+}
+
+// resolve returns when the link expires, nil for never.
+func (e expiry) resolve(now time.Time) (*time.Time, error) {
+	switch {
+	case e.ExpiresAt != nil && e.TTL != nil:
+		return nil, ErrIncorrectExpiry
+	case e.ExpiresAt != nil:
+		if !e.ExpiresAt.After(now) {
+			return nil, ErrIncorrectExpiry
+		}
+		return e.ExpiresAt, nil
+	case e.TTL != nil:
+		if *e.TTL <= 0 || *e.TTL > int64(math.MaxInt64/time.Second) {
+			return nil, ErrIncorrectExpiry
+		}
+		t := now.Add(time.Duration(*e.TTL) * time.Second)
+		return &t, nil
+	}
+
+	return nil, nil
+}
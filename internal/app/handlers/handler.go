@@ -10,8 +10,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/sessions"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/shortcode"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
-	"github.com/iryzzh/practicum-go-shortener/internal/pkg/utils"
 	"io"
 	"io/ioutil"
 	"log"
@@ -29,17 +29,26 @@ var (
 type Handler struct {
 	*chi.Mux
 
-	Store         store.Store
-	LinkLen       int
-	BaseURL       string
+	Store   store.Store
+	BaseURL string
+	// ReuseDeleted lets a deleted original url be shortened again: the
+	// deleted link is purged and the url gets a new short code.
+	ReuseDeleted bool
+	// CheckAlphabet is the alphabet of the check character that ends the
+	// generated codes, empty when they have none.
+	CheckAlphabet shortcode.Alphabet
+	// CodeLength is the length of the generated codes with their check
+	// character, zero when it varies. Only a code of that length is taken
+	// for a typo.
+	CodeLength int
+
 	sessionsStore *sessions.CookieStore
 	cookieName    string
 }
 
-func New(linkLen int, baseURL string, store store.Store, sessionKey []byte) *Handler {
+func New(baseURL string, store store.Store, sessionKey []byte) *Handler {
 	s := &Handler{
 		Mux:           chi.NewMux(),
-		LinkLen:       linkLen,
 		BaseURL:       baseURL,
 		Store:         store,
 		sessionsStore: sessions.NewCookieStore(sessionKey),
@@ -104,37 +113,46 @@ func (s *Handler) deleteUrls(r *http.Request, values []string) {
 		}
 	}()
 
+	// the response has already been sent and the request context is done,
+	// so the deletion runs on its own
+	ctx := context.Background()
+
 	session, _ := s.sessionsStore.Get(r, s.cookieName)
 	if session.Values["uuid"] == nil {
 		return
 	}
-	user, err := s.Store.User().FindByUUID(session.Values["uuid"].(string))
-	if err != nil {
-		log.Println("ERR:", err)
-		return
-	}
-	urls, err := s.Store.URL().FindByUserID(user.ID)
-	if err != nil {
-		log.Println("user URL err:", err)
-		return
-	}
 
-	var ids []int
-	for _, url := range urls {
-		for _, v := range values {
-			if url.URLShort == v {
-				if !url.IsDeleted {
-					ids = append(ids, url.ID)
+	// the urls are looked up and deleted in one transaction so that they
+	// can not change hands in between
+	err := s.Store.WithTx(ctx, func(tx store.Store) error {
+		user, err := tx.User().FindByUUID(ctx, session.Values["uuid"].(string))
+		if err != nil {
+			return err
+		}
+		urls, err := tx.URL().FindByUserID(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		var ids []int
+		for _, url := range urls {
+			for _, v := range values {
+				if url.URLShort == v {
+					if !url.IsDeleted {
+						ids = append(ids, url.ID)
+					}
 				}
 			}
 		}
-	}
 
-	if len(ids) > 0 {
-		err := s.Store.URL().BatchDelete(ids)
-		if err != nil {
-			log.Println("delete error:", err)
+		if len(ids) == 0 {
+			return nil
 		}
+
+		return tx.URL().BatchDelete(ctx, ids)
+	})
+	if err != nil {
+		log.Println("delete error:", err)
 	}
 }
 
@@ -152,6 +170,8 @@ func (s *Handler) batch(w http.ResponseWriter, r *http.Request) {
 		CorrelationID string  `json:"correlation_id"`
 		OriginalURL   *string `json:"original_url,omitempty"`
 		ShortURL      *string `json:"short_url,omitempty"`
+		expiry
+		alias
 	}
 
 	var result []data
@@ -159,34 +179,69 @@ func (s *Handler) batch(w http.ResponseWriter, r *http.Request) {
 	err = json.Unmarshal(b, &result)
 	if err != nil {
 		s.fail(w, err)
+		return
 	}
 
+	now := time.Now()
+	urls := make([]*model.URL, len(result))
 	for i, v := range result {
-		shortURL := utils.RandString(s.LinkLen)
+		if v.OriginalURL == nil {
+			s.fail(w, ErrIncorrectURL)
+			return
+		}
 
-		if err := s.Store.URL().Create(&model.URL{
-			URLOrigin: *v.OriginalURL,
-			URLShort:  shortURL,
-		}); err != nil {
+		expiresAt, err := v.resolve(now)
+		if err != nil {
+			s.fail(w, err)
+			return
+		}
+		short, err := v.short()
+		if err != nil {
 			s.fail(w, err)
 			return
 		}
 
-		str := s.BaseURL + "/" + shortURL
-		result[i].OriginalURL = nil
-		result[i].ShortURL = &str
+		urls[i] = &model.URL{
+			URLOrigin: *v.OriginalURL,
+			URLShort:  short,
+			ExpiresAt: expiresAt,
+		}
 	}
 
-	w.WriteHeader(http.StatusCreated)
-
-	if err := json.NewEncoder(w).Encode(result); err != nil {
+	created, err := s.batchCreate(r.Context(), urls)
+	if errors.Is(err, store.ErrShortExist) {
+		s.failWith(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
 		s.fail(w, err)
 		return
 	}
+
+	var count int
+	for i, url := range urls {
+		if created[i] {
+			count++
+		}
+
+		str := s.BaseURL + "/" + url.URLShort
+		result[i].OriginalURL = nil
+		result[i].ShortURL = &str
+		result[i].expiry = expiry{}
+		result[i].alias = alias{}
+	}
+
+	// conflict only when every url of the batch was already there
+	statusCode := http.StatusCreated
+	if count == 0 && len(urls) > 0 {
+		statusCode = http.StatusConflict
+	}
+
+	encodeJSON(w, statusCode, result)
 }
 
 func (s *Handler) Status(w http.ResponseWriter, r *http.Request) {
-	if err := s.Store.Ping(); err != nil {
+	if err := s.Store.Ping(r.Context()); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -194,10 +249,16 @@ func (s *Handler) Status(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Handler) userUrls(w http.ResponseWriter, r *http.Request) {
+	q, err := parseURLQuery(r)
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
 	session, _ := s.sessionsStore.Get(r, s.cookieName)
 
 	if session.Values["uuid"] != nil {
-		user, err := s.Store.User().FindByUUID(session.Values["uuid"].(string))
+		user, err := s.Store.User().FindByUUID(r.Context(), session.Values["uuid"].(string))
 		if errors.Is(err, store.ErrUserNotFound) {
 			w.WriteHeader(http.StatusNoContent)
 			return
@@ -214,12 +275,23 @@ func (s *Handler) userUrls(w http.ResponseWriter, r *http.Request) {
 
 		var resp []response
 
-		urls, err := s.Store.URL().FindByUserID(user.ID)
+		// one more url than asked tells whether there is a next page
+		limit := q.Limit
+		if limit > 0 {
+			q.Limit++
+		}
+
+		urls, err := s.Store.URL().FindByUserIDPage(r.Context(), user.ID, q)
 		if err != nil {
 			s.fail(w, err)
 			return
 		}
 
+		if limit > 0 && len(urls) > limit {
+			urls = urls[:limit]
+			w.Header().Set("Link", nextLink(r, urls[limit-1]))
+		}
+
 		for _, v := range urls {
 			resp = append(resp, response{
 				ShortURL:    s.BaseURL + "/" + v.URLShort,
@@ -231,8 +303,8 @@ func (s *Handler) userUrls(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("content-type", "application/json")
 			if err := json.NewEncoder(w).Encode(resp); err != nil {
 				s.fail(w, err)
-				return
 			}
+			return
 		}
 	}
 
@@ -245,7 +317,7 @@ func (s *Handler) SessionsHandler(next http.Handler) http.Handler {
 		if session.Values["uuid"] == nil {
 			user := &model.User{}
 			user.UUID = uuid.New().String()
-			if err := s.Store.User().Create(user); err == nil {
+			if err := s.Store.User().Create(r.Context(), user); err == nil {
 				session.Values["uuid"] = user.UUID
 				if err := session.Save(r, w); err != nil {
 					log.Println("session save error:", err)
@@ -272,29 +344,48 @@ func gzipMiddleware(next http.Handler) http.Handler {
 
 func (s *Handler) shorten(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
-	url := &model.URL{}
 
-	err := json.NewDecoder(r.Body).Decode(&url)
-	if err != nil || len(url.URLOrigin) < minURLLength {
+	var req struct {
+		URL string `json:"url"`
+		expiry
+		alias
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || len(req.URL) < minURLLength {
 		s.fail(w, ErrIncorrectURL)
 		return
 	}
 
-	url.URLShort = utils.RandString(s.LinkLen)
+	expiresAt, err := req.resolve(time.Now())
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+	short, err := req.short()
+	if err != nil {
+		s.fail(w, err)
+		return
+	}
+
+	url := &model.URL{
+		URLOrigin: req.URL,
+		URLShort:  short,
+		ExpiresAt: expiresAt,
+	}
 
-	err = s.Store.URL().Create(url)
+	err = s.createURL(r, url)
 	if errors.Is(err, store.ErrURLExist) {
 		encodeJSON(w, http.StatusConflict, map[string]interface{}{
 			"result": s.BaseURL + "/" + url.URLShort,
 		})
 		return
 	}
-	if err != nil {
-		s.fail(w, err)
+	if errors.Is(err, store.ErrShortExist) {
+		s.failWith(w, http.StatusConflict, err)
 		return
 	}
-
-	if err := s.SaveURL(r, url); err != nil {
+	if err != nil {
 		s.fail(w, err)
 		return
 	}
@@ -311,19 +402,105 @@ func encodeJSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	}
 }
 
-func (s *Handler) SaveURL(r *http.Request, url *model.URL) error {
-	session, _ := s.sessionsStore.Get(r, s.cookieName)
-	if session.Values["uuid"] != nil {
-		user, err := s.Store.User().FindByUUID(session.Values["uuid"].(string))
-		if err != nil {
+// createURL creates the url for the session user. The owner is set before
+// the url is created, a store which deduplicates per user looks for the
+// original url among the urls of the owner only. Only reusing a deleted url
+// takes a transaction, a plain create is a single call of the store and
+// does not hold up the others.
+func (s *Handler) createURL(r *http.Request, url *model.URL) error {
+	user, err := s.sessionUser(r, s.Store)
+	if err != nil {
+		return err
+	}
+	if user != nil {
+		url.UserID = user.ID
+	}
+
+	if !s.ReuseDeleted {
+		return s.Store.URL().Create(r.Context(), url)
+	}
+
+	return s.Store.WithTx(r.Context(), func(tx store.Store) error {
+		v := *url
+		err := tx.URL().Create(r.Context(), url)
+		if errors.Is(err, store.ErrURLExist) && url.IsDeleted {
+			if err := tx.URL().Purge(r.Context(), []int{url.ID}); err != nil {
+				return err
+			}
+			*url = v
+			err = tx.URL().Create(r.Context(), url)
+		}
+
+		return err
+	})
+}
+
+// batchCreate works like createURL for a batch which is not assigned to
+// anybody.
+func (s *Handler) batchCreate(ctx context.Context, urls []*model.URL) ([]bool, error) {
+	if !s.ReuseDeleted {
+		return s.Store.URL().BatchCreate(ctx, urls)
+	}
+
+	var created []bool
+
+	err := s.Store.WithTx(ctx, func(tx store.Store) error {
+		requested := make([]model.URL, len(urls))
+		for i, url := range urls {
+			requested[i] = *url
+		}
+
+		var err error
+		if created, err = tx.URL().BatchCreate(ctx, urls); err != nil {
 			return err
 		}
-		if err := s.Store.URL().UpdateUserID(url, user.ID); err != nil {
+
+		var (
+			ids   []int
+			again []*model.URL
+			index []int
+		)
+		for i, url := range urls {
+			if created[i] || !url.IsDeleted {
+				continue
+			}
+			ids = append(ids, url.ID)
+			*url = requested[i]
+			again = append(again, url)
+			index = append(index, i)
+		}
+		if len(again) == 0 {
+			return nil
+		}
+
+		if err := tx.URL().Purge(ctx, ids); err != nil {
 			return err
 		}
+		recreated, err := tx.URL().BatchCreate(ctx, again)
+		if err != nil {
+			return err
+		}
+		for j, i := range index {
+			created[i] = recreated[j]
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return created, nil
+}
+
+// sessionUser finds the user of the session, nil if the session has none.
+func (s *Handler) sessionUser(r *http.Request, st store.Store) (*model.User, error) {
+	session, _ := s.sessionsStore.Get(r, s.cookieName)
+	if session.Values["uuid"] == nil {
+		return nil, nil
+	}
+
+	return st.User().FindByUUID(r.Context(), session.Values["uuid"].(string))
 }
 
 // https://pkg.go.dev/context#WithValue
@@ -332,13 +509,17 @@ type ctxKeyLocation struct{}
 func (s *Handler) ParseURL(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		id := chi.URLParam(r, "id")
-		url, err := s.Store.URL().FindByUUID(id)
+		url, err := s.Store.URL().FindByUUID(r.Context(), id)
+		if errors.Is(err, store.ErrRecordNotFound) && s.CheckAlphabet != "" && !s.CheckAlphabet.Valid(id) {
+			s.mistyped(w, r, id)
+			return
+		}
 		if err != nil {
 			s.fail(w, ErrIncorrectID)
 			return
 		}
 
-		if s.Store.URL().IsDeleted(url.ID) {
+		if url.Expired(time.Now()) || s.Store.URL().IsDeleted(r.Context(), url.ID) {
 			w.WriteHeader(http.StatusGone)
 			return
 		}
@@ -374,20 +555,19 @@ func (s *Handler) PostHandler(w http.ResponseWriter, r *http.Request) {
 
 	url := &model.URL{
 		URLOrigin: string(b),
-		URLShort:  utils.RandString(s.LinkLen),
 	}
 
-	err = s.Store.URL().Create(url)
+	err = s.createURL(r, url)
 	if errors.Is(err, store.ErrURLExist) {
 		basicResponse(w, http.StatusConflict, []byte(s.BaseURL+"/"+url.URLShort))
 		return
 	}
-	if err != nil {
-		s.fail(w, err)
+	// the body is the url here, so it is the request which is too large
+	if errors.Is(err, model.ErrURLTooLong) {
+		s.failWith(w, http.StatusRequestEntityTooLarge, err)
 		return
 	}
-
-	if err := s.SaveURL(r, url); err != nil {
+	if err != nil {
 		s.fail(w, err)
 		return
 	}
@@ -401,7 +581,11 @@ func basicResponse(w http.ResponseWriter, statusCode int, body []byte) {
 }
 
 func (s *Handler) fail(w http.ResponseWriter, e error) {
-	w.WriteHeader(http.StatusBadRequest)
+	s.failWith(w, http.StatusBadRequest, e)
+}
+
+func (s *Handler) failWith(w http.ResponseWriter, statusCode int, e error) {
+	w.WriteHeader(statusCode)
 
 	type errorResponse struct {
 		Error string `json:"error"`
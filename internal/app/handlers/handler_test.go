@@ -7,6 +7,7 @@ import (
 	"github.com/iryzzh/practicum-go-shortener/cmd/shortener/config"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/handlers"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/shortcode"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/store/memstore"
 	"github.com/stretchr/testify/assert"
@@ -21,11 +22,12 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
-func newTestServer(st store.Store) (*httptest.Server, error) {
+func newTestServer(st store.Store, configure ...func(h *handlers.Handler)) (*httptest.Server, error) {
 	cfg, err := config.New()
 	if err != nil {
 		return nil, err
@@ -36,7 +38,10 @@ func newTestServer(st store.Store) (*httptest.Server, error) {
 		log.Fatal(err)
 	}
 
-	handler := handlers.New(cfg.URLLen, cfg.BaseURL, st, []byte(cfg.SessionKey))
+	handler := handlers.New(cfg.BaseURL, st, []byte(cfg.SessionKey))
+	for _, fn := range configure {
+		fn(handler)
+	}
 
 	ts := httptest.NewUnstartedServer(handler)
 	ts.Listener.Close()
@@ -77,7 +82,7 @@ func testRequest(t *testing.T, method, path string, body io.Reader, jar *cookiej
 func TestHandler_Get(t *testing.T) {
 	st := memstore.New()
 	url := model.TestURL(t)
-	if err := st.URL().Create(url); err != nil {
+	if err := st.URL().Create(context.Background(), url); err != nil {
 		t.Fatal(err)
 	}
 
@@ -129,6 +134,320 @@ func TestHandler_Get(t *testing.T) {
 	}
 }
 
+func TestHandler_Get_Expired(t *testing.T) {
+	st := memstore.New()
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Second)
+	expired := model.TestURLGenerated(t)
+	expired.ExpiresAt = &past
+	require.NoError(t, st.URL().Create(ctx, expired))
+
+	future := time.Now().Add(time.Hour)
+	live := model.TestURLGenerated(t)
+	live.ExpiresAt = &future
+	require.NoError(t, st.URL().Create(ctx, live))
+
+	ts, err := newTestServer(st)
+	require.NoError(t, err)
+	defer ts.Close()
+
+	resp, _ := testRequest(t, "GET", ts.URL+"/"+expired.URLShort, nil, nil)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+	resp, _ = testRequest(t, "GET", ts.URL+"/"+live.URLShort, nil, nil)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, live.URLOrigin, resp.Header.Get("Location"))
+}
+
+func TestHandler_ReuseDeleted(t *testing.T) {
+	st := memstore.New()
+	ctx := context.Background()
+
+	deleted := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(ctx, deleted))
+	require.NoError(t, st.URL().Delete(ctx, deleted))
+
+	batchDeleted := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(ctx, batchDeleted))
+	require.NoError(t, st.URL().Delete(ctx, batchDeleted))
+
+	ts, err := newTestServer(st, func(h *handlers.Handler) {
+		h.ReuseDeleted = true
+	})
+	require.NoError(t, err)
+	defer ts.Close()
+
+	resp, body := testRequest(t, "POST", ts.URL+"/api/shorten", strings.NewReader(`{"url":"`+deleted.URLOrigin+`"}`), nil)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var result struct {
+		Result string `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &result))
+	assert.NotEqual(t, deleted.URLShort, filepath.Base(result.Result))
+
+	_, err = st.URL().FindByUUID(ctx, deleted.URLShort)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	resp, _ = testRequest(t, "GET", result.Result, nil, nil)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, deleted.URLOrigin, resp.Header.Get("Location"))
+
+	fresh := model.TestURLGenerated(t)
+	batch := `[{"correlation_id":"1","original_url":"` + batchDeleted.URLOrigin + `"},` +
+		`{"correlation_id":"2","original_url":"` + fresh.URLOrigin + `"}]`
+	resp, body = testRequest(t, "POST", ts.URL+"/api/shorten/batch", strings.NewReader(batch), nil)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var results []struct {
+		ShortURL string `json:"short_url"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &results))
+	require.Len(t, results, 2)
+	short := filepath.Base(results[0].ShortURL)
+	assert.NotEqual(t, batchDeleted.URLShort, short)
+
+	u, err := st.URL().FindByUUID(ctx, short)
+	require.NoError(t, err)
+	assert.Equal(t, batchDeleted.URLOrigin, u.URLOrigin)
+	assert.False(t, u.IsDeleted)
+}
+
+func TestHandler_DedupUser(t *testing.T) {
+	st := memstore.New(memstore.WithOptions(store.Options{Dedup: store.DedupUser}))
+
+	ts, err := newTestServer(st)
+	require.NoError(t, err)
+	defer ts.Close()
+
+	origin := model.TestURLGenerated(t).URLOrigin
+	jars := make([]*cookiejar.Jar, 2)
+	shorts := make([]string, 2)
+	for i := range jars {
+		jars[i], err = cookiejar.New(nil)
+		require.NoError(t, err)
+
+		resp, body := testRequest(t, "POST", ts.URL, strings.NewReader(origin), jars[i])
+		resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		shorts[i] = filepath.Base(body)
+	}
+	assert.NotEqual(t, shorts[0], shorts[1])
+
+	// the conflict is only for the same user
+	resp, body := testRequest(t, "POST", ts.URL+"/api/shorten", strings.NewReader(`{"url":"`+origin+`"}`), jars[1])
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Contains(t, body, shorts[1])
+
+	for i, jar := range jars {
+		resp, body := testRequest(t, "GET", ts.URL+"/api/user/urls", nil, jar)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var urls []struct {
+			ShortURL    string `json:"short_url"`
+			OriginalURL string `json:"original_url"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &urls))
+		require.Len(t, urls, 1)
+		assert.Equal(t, shorts[i], filepath.Base(urls[0].ShortURL))
+		assert.Equal(t, origin, urls[0].OriginalURL)
+	}
+}
+
+func TestHandler_LongURL(t *testing.T) {
+	ts, err := newTestServer(memstore.New())
+	require.NoError(t, err)
+	defer ts.Close()
+
+	origin := model.TestURLGenerated(t).URLOrigin + "?utm="
+	long := origin + strings.Repeat("x", 1000)
+	tooLong := origin + strings.Repeat("x", model.DefaultMaxURLLength)
+
+	resp, body := testRequest(t, "POST", ts.URL, strings.NewReader(long), nil)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, body = testRequest(t, "GET", ts.URL+"/"+filepath.Base(body), nil, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, long, resp.Header.Get("Location"))
+
+	resp, body = testRequest(t, "POST", ts.URL, strings.NewReader(tooLong), nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.Contains(t, body, model.ErrURLTooLong.Error())
+
+	resp, body = testRequest(t, "POST", ts.URL+"/api/shorten", strings.NewReader(`{"url":"`+tooLong+`"}`), nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body, model.ErrURLTooLong.Error())
+
+	resp, body = testRequest(t, "POST", ts.URL+"/api/shorten/batch", strings.NewReader(`[{"correlation_id":"1","original_url":"`+tooLong+`"}]`), nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body, model.ErrURLTooLong.Error())
+}
+
+func TestHandler_Alias(t *testing.T) {
+	ts, err := newTestServer(memstore.New())
+	require.NoError(t, err)
+	defer ts.Close()
+
+	origin := model.TestURLGenerated(t).URLOrigin
+
+	resp, body := testRequest(t, "POST", ts.URL+"/api/shorten", strings.NewReader(`{"url":"`+origin+`","alias":"my-link"}`), nil)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Contains(t, body, "/my-link")
+
+	resp, _ = testRequest(t, "GET", ts.URL+"/my-link", nil, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, origin, resp.Header.Get("Location"))
+
+	other := model.TestURLGenerated(t).URLOrigin
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{"taken", "/api/shorten", `{"url":"` + other + `","alias":"my-link"}`, http.StatusConflict},
+		{"reserved", "/api/shorten", `{"url":"` + other + `","alias":"api"}`, http.StatusBadRequest},
+		{"too short", "/api/shorten", `{"url":"` + other + `","alias":"ab"}`, http.StatusBadRequest},
+		{"wrong alphabet", "/api/shorten", `{"url":"` + other + `","alias":"my/link"}`, http.StatusBadRequest},
+		{"batch taken", "/api/shorten/batch", `[{"correlation_id":"1","original_url":"` + other + `","alias":"my-link"}]`, http.StatusConflict},
+		{"batch reserved", "/api/shorten/batch", `[{"correlation_id":"1","original_url":"` + other + `","alias":"ping"}]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := testRequest(t, "POST", ts.URL+tt.path, strings.NewReader(tt.body), nil)
+			resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+
+	resp, body = testRequest(t, "POST", ts.URL+"/api/shorten/batch", strings.NewReader(`[{"correlation_id":"1","original_url":"`+other+`","alias":"other_link"}]`), nil)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Contains(t, body, "/other_link")
+	assert.NotContains(t, body, `"alias"`)
+}
+
+func TestHandler_Mistyped(t *testing.T) {
+	alphabet := shortcode.Crockford
+	gen := shortcode.NewChecked(shortcode.NewSequential(4, alphabet), alphabet)
+	st := memstore.New(memstore.WithOptions(store.Options{Generator: gen}))
+	ctx := context.Background()
+
+	url := model.TestURLGenerated(t)
+	url.URLShort = ""
+	require.NoError(t, st.URL().Create(ctx, url))
+	require.True(t, alphabet.Valid(url.URLShort))
+
+	ts, err := newTestServer(st, func(h *handlers.Handler) {
+		h.CheckAlphabet = alphabet
+	})
+	require.NoError(t, err)
+	defer ts.Close()
+
+	typo := url.URLShort[:1] + "x" + url.URLShort[2:]
+	if typo == url.URLShort {
+		typo = url.URLShort[:1] + "y" + url.URLShort[2:]
+	}
+
+	resp, body := testRequest(t, "GET", ts.URL+"/"+typo, nil, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("content-type"), "text/html")
+	assert.Contains(t, body, "mistyped")
+	assert.Contains(t, body, `href="http://localhost:8080/`+url.URLShort+`"`)
+
+	// a valid code which is not there is unknown, not mistyped
+	unknown := shortcode.NewChecked(shortcode.NewSequential(4, alphabet), alphabet).Generate(url.ID+1, 0)
+	resp, body = testRequest(t, "GET", ts.URL+"/"+unknown, nil, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NotContains(t, body, "mistyped")
+
+	resp, _ = testRequest(t, "GET", ts.URL+"/"+url.URLShort, nil, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+}
+
+// countingStore counts the FindByUUID calls which reach the wrapped store.
+type countingStore struct {
+	store.Store
+	lookups int64
+}
+
+func (s *countingStore) URL() store.URLRepository {
+	return &countingURLRepository{URLRepository: s.Store.URL(), store: s}
+}
+
+type countingURLRepository struct {
+	store.URLRepository
+	store *countingStore
+}
+
+func (r *countingURLRepository) FindByUUID(ctx context.Context, uuid string) (*model.URL, error) {
+	atomic.AddInt64(&r.store.lookups, 1)
+	return r.URLRepository.FindByUUID(ctx, uuid)
+}
+
+func TestHandler_MistypedLookups(t *testing.T) {
+	alphabet := shortcode.Crockford
+	gen := shortcode.NewChecked(shortcode.NewSequential(4, alphabet), alphabet)
+	st := &countingStore{Store: memstore.New(memstore.WithOptions(store.Options{Generator: gen}))}
+
+	url := model.TestURLGenerated(t)
+	url.URLShort = ""
+	require.NoError(t, st.URL().Create(context.Background(), url))
+
+	lookups := func(codeLength int, code string) int64 {
+		ts, err := newTestServer(st, func(h *handlers.Handler) {
+			h.CheckAlphabet = alphabet
+			h.CodeLength = codeLength
+		})
+		require.NoError(t, err)
+		defer ts.Close()
+
+		atomic.StoreInt64(&st.lookups, 0)
+		resp, _ := testRequest(t, "GET", ts.URL+"/"+code, nil, nil)
+		resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		return atomic.LoadInt64(&st.lookups)
+	}
+
+	long := strings.Repeat("1", 30)
+	if alphabet.Valid(long) {
+		long = long[:29] + "2"
+	}
+	// the code itself and then at most 16 of its corrections
+	assert.Equal(t, int64(17), lookups(0, long))
+	// a code of another length than the generated ones is not looked into
+	assert.Equal(t, int64(1), lookups(len(url.URLShort), long))
+
+	typo := url.URLShort[:1] + "x" + url.URLShort[2:]
+	if typo == url.URLShort {
+		typo = url.URLShort[:1] + "y" + url.URLShort[2:]
+	}
+	// a substitution or a swap at each position
+	n := lookups(len(url.URLShort), typo)
+	assert.Greater(t, n, int64(1))
+	assert.LessOrEqual(t, n, int64(1+len(typo)+len(typo)-1))
+}
+
 func TestHandler_Post(t *testing.T) {
 	st := memstore.New()
 
@@ -170,7 +489,7 @@ func TestHandler_Post(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if tt.want.code == http.StatusConflict {
-				if err := st.URL().Create(model.TestURL(t)); err != nil {
+				if err := st.URL().Create(context.Background(), model.TestURL(t)); err != nil {
 					t.Fatal(err)
 				}
 			}
@@ -229,12 +548,37 @@ func TestHandler_API_Shorten_Post(t *testing.T) {
 			body:           map[string]interface{}{"url": model.TestURL(t).URLOrigin},
 			wantStatusCode: http.StatusConflict,
 		},
+		{
+			name:           "test ttl",
+			body:           map[string]interface{}{"url": "http://ttl.example.com", "ttl": 3600},
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "test expires_at",
+			body:           map[string]interface{}{"url": "http://expires.example.com", "expires_at": time.Now().Add(time.Hour)},
+			wantStatusCode: http.StatusCreated,
+		},
+		{
+			name:           "test expires_at in the past",
+			body:           map[string]interface{}{"url": "http://past.example.com", "expires_at": time.Now().Add(-time.Hour)},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "test ttl and expires_at",
+			body:           map[string]interface{}{"url": "http://both.example.com", "ttl": 60, "expires_at": time.Now().Add(time.Hour)},
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "test negative ttl",
+			body:           map[string]interface{}{"url": "http://negative.example.com", "ttl": -1},
+			wantStatusCode: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if tt.wantStatusCode == http.StatusConflict {
-				if err := st.URL().Create(model.TestURL(t)); err != nil {
+				if err := st.URL().Create(context.Background(), model.TestURL(t)); err != nil {
 					t.Fatal(err)
 				}
 			}
@@ -302,6 +646,16 @@ func TestHandler_API_Shorten_Batch(t *testing.T) {
 			},
 			wantStatusCode: http.StatusCreated,
 		},
+		{
+			name: "test existing batch",
+			body: Request{
+				{
+					CorrelationID: "c3e3e0a4-6f1a-4d8e-9c39-1b7f0d2f6a11",
+					OriginalURL:   "http://wixbzuqq.yandex/whlbtt0uq0/ytutnpencn839",
+				},
+			},
+			wantStatusCode: http.StatusConflict,
+		},
 		{
 			name: "test incorrect batch",
 			body: Request{
@@ -462,3 +816,71 @@ func TestHandler_API_User_Urls_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_API_User_Urls_Pagination(t *testing.T) {
+	st := memstore.New()
+	endpoint := "/api/user/urls"
+
+	ts, err := newTestServer(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []string
+	for i := 0; i < 5; i++ {
+		url := model.TestURLGenerated(t)
+
+		res, body := testRequest(t, "POST", ts.URL, strings.NewReader(url.URLOrigin), jar)
+		res.Body.Close()
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+
+		want = append(want, body)
+	}
+
+	type Response []struct {
+		ShortURL    string `json:"short_url"`
+		OriginalURL string `json:"original_url"`
+	}
+
+	var got []string
+	next := endpoint + "?limit=2"
+	for pages := 0; next != ""; pages++ {
+		require.Less(t, pages, 3)
+
+		res, body := testRequest(t, "GET", ts.URL+next, nil, jar)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var resp Response
+		require.NoError(t, json.Unmarshal([]byte(body), &resp))
+		assert.LessOrEqual(t, len(resp), 2)
+		for _, v := range resp {
+			got = append(got, v.ShortURL)
+		}
+
+		next = ""
+		if link := res.Header.Get("Link"); link != "" {
+			next = strings.TrimPrefix(strings.TrimSuffix(link, `>; rel="next"`), "<")
+		}
+	}
+	assert.Equal(t, want, got)
+
+	res, body := testRequest(t, "GET", ts.URL+endpoint+"?sort=-created&limit=1", nil, jar)
+	res.Body.Close()
+	var resp Response
+	require.NoError(t, json.Unmarshal([]byte(body), &resp))
+	require.Len(t, resp, 1)
+	assert.Equal(t, want[len(want)-1], resp[0].ShortURL)
+
+	for _, query := range []string{"?limit=0", "?sort=unknown", "?deleted=maybe", "?cursor=@@"} {
+		res, _ := testRequest(t, "GET", ts.URL+endpoint+query, nil, jar)
+		res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, query)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// maxSuggestions is how many links the page of a mistyped code offers.
+	maxSuggestions = 3
+	// maxLookups is how many of the corrections of a code are looked up.
+	maxLookups = 16
+)
+
+var mistypedPage = template.Must(template.New("mistyped").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Mistyped link</title></head>
+<body>
+<h1>This link looks mistyped</h1>
+<p>There is no link {{.Code}}, and it is not a code which could be made here.</p>
+{{- if .Suggestions}}
+<p>Did you mean:</p>
+<ul>
+{{- range .Suggestions}}
+<li><a href="{{.}}">{{.}}</a></li>
+{{- end}}
+</ul>
+{{- else}}
+<p>No link is a single typo away from it either.</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// mistyped answers a code which fails the check with the links whose codes
+// are a single edit away from it.
+func (s *Handler) mistyped(w http.ResponseWriter, r *http.Request, code string) {
+	var suggestions []string
+	if s.CodeLength == 0 || len(code) == s.CodeLength {
+		suggestions = s.suggest(r.Context(), code)
+	}
+
+	w.Header().Set("content-type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusBadRequest)
+	err := mistypedPage.Execute(w, struct {
+		Code        string
+		Suggestions []string
+	}{code, suggestions})
+	if err != nil {
+		log.Println("mistyped page:", err)
+	}
+}
+
+// suggest looks up the corrections of code of the generated length, until
+// maxSuggestions links are found or maxLookups codes are tried.
+func (s *Handler) suggest(ctx context.Context, code string) []string {
+	var suggestions []string
+	lookups := 0
+	for _, c := range s.CheckAlphabet.Corrections(code) {
+		if s.CodeLength != 0 && len(c) != s.CodeLength {
+			continue
+		}
+		if lookups == maxLookups {
+			break
+		}
+		lookups++
+
+		url, err := s.Store.URL().FindByUUID(ctx, c)
+		if err != nil || url.Expired(time.Now()) || s.Store.URL().IsDeleted(ctx, url.ID) {
+			continue
+		}
+
+		suggestions = append(suggestions, s.BaseURL+"/"+url.URLShort)
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+	}
+
+	return suggestions
+}
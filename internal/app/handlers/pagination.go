@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrIncorrectQuery = errors.New("incorrect query")
+	maxPageLimit      = 1000
+)
+
+// parseURLQuery reads the page of /api/user/urls the request asks for:
+//
+//	limit         page size, all urls when empty
+//	cursor        the cursor from the Link header of the previous page
+//	sort          created or short, a leading "-" reverses the order
+//	deleted       include (the default) or exclude
+//	original_url  keeps the urls whose original URL contains it
+func parseURLQuery(r *http.Request) (store.URLQuery, error) {
+	var q store.URLQuery
+	values := r.URL.Query()
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return q, ErrIncorrectQuery
+		}
+		if limit > maxPageLimit {
+			limit = maxPageLimit
+		}
+		q.Limit = limit
+	}
+
+	sort := values.Get("sort")
+	if strings.HasPrefix(sort, "-") {
+		q.Desc = true
+		sort = sort[1:]
+	}
+	switch sort {
+	case "", "created":
+		q.Sort = store.SortByCreation
+	case "short":
+		q.Sort = store.SortByShort
+	default:
+		return q, ErrIncorrectQuery
+	}
+
+	switch values.Get("deleted") {
+	case "", "include":
+	case "exclude":
+		q.ExcludeDeleted = true
+	default:
+		return q, ErrIncorrectQuery
+	}
+
+	q.OriginContains = values.Get("original_url")
+
+	if v := values.Get("cursor"); v != "" {
+		after, err := decodeCursor(v)
+		if err != nil {
+			return q, ErrIncorrectQuery
+		}
+		q.After = after
+	}
+
+	return q, nil
+}
+
+// encodeCursor makes an opaque cursor pointing after the url. It carries
+// both the ID and the short code, so it works with either order.
+func encodeCursor(url *model.URL) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(url.ID) + ":" + url.URLShort))
+}
+
+func decodeCursor(cursor string) (*model.URL, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	id, short, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return nil, ErrIncorrectQuery
+	}
+
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.URL{ID: n, URLShort: short}, nil
+}
+
+// nextLink is the Link header value for the page after the url.
+func nextLink(r *http.Request, last *model.URL) string {
+	u := *r.URL
+	values := u.Query()
+	values.Set("cursor", encodeCursor(last))
+	u.RawQuery = values.Encode()
+
+	return "<" + u.RequestURI() + `>; rel="next"`
+}
@@ -1,9 +1,23 @@
 package model
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"regexp"
+	"time"
+)
+
+// DefaultMaxURLLength is the longest original url the stores accept unless
+// they are told otherwise.
+const DefaultMaxURLLength = 2048
+
+var (
+	ErrURLTooLong = errors.New("url is too long")
+
+	reHTTP   = regexp.MustCompile(`https?://`)
+	reHost   = regexp.MustCompile(`:.*`)
+	reDomain = regexp.MustCompile(`^(?:[a-zA-Z\d](?:[a-zA-Z\d-]{0,61}[a-z\d])?\.)+(?:[a-zA-Z]{1,63}| xn--[a-z\d]{1,59})$`)
 )
 
 type URL struct {
@@ -12,25 +26,83 @@ type URL struct {
 	URLShort  string `json:"url_short,omitempty"`
 	UserID    int    `json:"user_id,omitempty"`
 	IsDeleted bool   `json:"is_deleted"`
+
+	// ExpiresAt is when the link stops working, nil for never.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// DeletedAt is when the link has been deleted. A deleted link without
+	// it has been deleted before the time was kept and counts as deleted
+	// long ago.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
-func (u *URL) Validate() error {
-	reHTTP := regexp.MustCompile(`https?://`)
+// Validate adds the scheme the original url lacks and checks it, it is
+// at most maxLength characters long with the scheme unless maxLength is not
+// positive.
+func (u *URL) Validate(maxLength int) error {
 	if !reHTTP.MatchString(u.URLOrigin) {
 		u.URLOrigin = "https://" + u.URLOrigin
 	}
+	if maxLength > 0 && len(u.URLOrigin) > maxLength {
+		return fmt.Errorf("%w: %d characters, at most %d", ErrURLTooLong, len(u.URLOrigin), maxLength)
+	}
 	t, err := url.Parse(u.URLOrigin)
 	if err != nil {
 		return err
 	}
 
-	reHost := regexp.MustCompile(`:.*`)
-	reDomain := regexp.MustCompile(`^(?:[a-zA-Z\d](?:[a-zA-Z\d-]{0,61}[a-z\d])?\.)+(?:[a-zA-Z]{1,63}| xn--[a-z\d]{1,59})$`)
 	host := reHost.ReplaceAllString(t.Host, "")
 
 	if !reDomain.MatchString(host) {
 		return fmt.Errorf("invalid host: %v", u.URLOrigin)
 	}
 
+	u.ExpiresAt = Timestamp(u.ExpiresAt)
+
 	return nil
 }
+
+// Timestamp brings t to the form every store keeps: UTC with microseconds,
+// the precision of PostgreSQL.
+func Timestamp(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	v := t.UTC().Truncate(time.Microsecond)
+
+	return &v
+}
+
+// Now is the current time as Timestamp returns it.
+func Now() *time.Time {
+	t := time.Now()
+
+	return Timestamp(&t)
+}
+
+// Expired reports whether the link has stopped working at now.
+func (u *URL) Expired(now time.Time) bool {
+	return u.ExpiresAt != nil && !now.Before(*u.ExpiresAt)
+}
+
+// DeletedBy reports whether the link had been deleted at t.
+func (u *URL) DeletedBy(t time.Time) bool {
+	return u.IsDeleted && (u.DeletedAt == nil || !u.DeletedAt.After(t))
+}
+
+// Equal compares every field, the times by the instants they stand for.
+func (u *URL) Equal(v *URL) bool {
+	a, b := *u, *v
+	a.ExpiresAt, b.ExpiresAt = nil, nil
+	a.DeletedAt, b.DeletedAt = nil, nil
+
+	return a == b && sameTime(u.ExpiresAt, v.ExpiresAt) && sameTime(u.DeletedAt, v.DeletedAt)
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
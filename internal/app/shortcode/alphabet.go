@@ -0,0 +1,89 @@
+package shortcode
+
+import "fmt"
+
+// Alphabet is the characters the codes are made of, at most 64 of them.
+type Alphabet string
+
+const (
+	// Base62 is every letter in both cases and every digit.
+	Base62 Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	// Crockford is Crockford's base32 in lower case: the digits and the
+	// letters but i, l, o and u, which are read as 1, 1, 0 or taken for v.
+	Crockford Alphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+	// Lowercase is the digits and the lower case letters, for codes which
+	// are found whatever case they are typed in.
+	Lowercase Alphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+	// Unambiguous is Base62 without 0, 1, O, I and l, which look alike.
+	Unambiguous Alphabet = "23456789abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+)
+
+// ParseAlphabet reads the name of an alphabet: base62, the default,
+// crockford, lowercase or unambiguous.
+func ParseAlphabet(name string) (Alphabet, error) {
+	switch name {
+	case "", "base62":
+		return Base62, nil
+	case "crockford":
+		return Crockford, nil
+	case "lowercase":
+		return Lowercase, nil
+	case "unambiguous":
+		return Unambiguous, nil
+	default:
+		return "", fmt.Errorf("unknown short code alphabet: %s", name)
+	}
+}
+
+func (a Alphabet) base() uint64 {
+	return uint64(len(a))
+}
+
+// maxDigits is the longest code of the alphabet whose number still fits
+// uint64 arithmetic.
+func (a Alphabet) maxDigits() int {
+	n := 0
+	for v := uint64(1); v <= (1<<63)/a.base(); v *= a.base() {
+		n++
+	}
+
+	return n
+}
+
+// encode writes v with the alphabet as digits, padded with the first one to
+// length.
+func (a Alphabet) encode(v uint64, length int) string {
+	var b []byte
+	for v > 0 {
+		b = append(b, a[v%a.base()])
+		v /= a.base()
+	}
+	for len(b) < length || len(b) == 0 {
+		b = append(b, a[0])
+	}
+
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+
+	return string(b)
+}
+
+func (a Alphabet) digits(v uint64) int {
+	n := 1
+	for v >= a.base() {
+		v /= a.base()
+		n++
+	}
+
+	return n
+}
+
+func (a Alphabet) pow(n int) uint64 {
+	v := uint64(1)
+	for i := 0; i < n; i++ {
+		v *= a.base()
+	}
+
+	return v
+}
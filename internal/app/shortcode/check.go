@@ -0,0 +1,88 @@
+package shortcode
+
+import "strings"
+
+// Checked ends the codes of its generator with a check character of the
+// alphabet, the Luhn mod N one. It changes with any single character which
+// is mistyped and with most two neighbours which are swapped, so Valid
+// tells a mistyped code from one which is not there.
+type Checked struct {
+	gen      Generator
+	alphabet Alphabet
+}
+
+func NewChecked(gen Generator, alphabet Alphabet) *Checked {
+	return &Checked{gen: gen, alphabet: alphabet}
+}
+
+func (g *Checked) Generate(id, attempt int) string {
+	code := g.gen.Generate(id, attempt)
+	c, _ := g.alphabet.check(code)
+
+	return code + string(c)
+}
+
+// Valid tells whether the code ends with its check character.
+func (a Alphabet) Valid(code string) bool {
+	if len(code) < 2 {
+		return false
+	}
+
+	c, ok := a.check(code[:len(code)-1])
+
+	return ok && c == code[len(code)-1]
+}
+
+// Corrections are the valid codes a single edit away from code: a
+// character replaced, two neighbours swapped, one left out or one added.
+// The likelier typos come first.
+func (a Alphabet) Corrections(code string) []string {
+	var result []string
+	seen := map[string]bool{code: true}
+	add := func(v string) {
+		if !seen[v] && a.Valid(v) {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+
+	for i := range code {
+		for j := range a {
+			add(code[:i] + string(a[j]) + code[i+1:])
+		}
+	}
+	for i := 0; i+1 < len(code); i++ {
+		add(code[:i] + code[i+1:i+2] + code[i:i+1] + code[i+2:])
+	}
+	for i := range code {
+		add(code[:i] + code[i+1:])
+	}
+	for i := 0; i <= len(code); i++ {
+		for j := range a {
+			add(code[:i] + string(a[j]) + code[i:])
+		}
+	}
+
+	return result
+}
+
+// check is the Luhn mod N check character of code, false when code has a
+// character out of the alphabet.
+func (a Alphabet) check(code string) (byte, bool) {
+	n := len(a)
+	factor := 2
+	sum := 0
+
+	for i := len(code) - 1; i >= 0; i-- {
+		v := strings.IndexByte(string(a), code[i])
+		if v < 0 {
+			return 0, false
+		}
+
+		v *= factor
+		sum += v/n + v%n
+		factor = 3 - factor
+	}
+
+	return a[(n-sum%n)%n], true
+}
@@ -0,0 +1,90 @@
+package shortcode
+
+import (
+	"bufio"
+	_ "embed"
+	"expvar"
+	"io"
+	"strings"
+)
+
+// FilterAttempts is how many codes Filtered asks for before it gives up and
+// takes a blocked one.
+const FilterAttempts = 100
+
+var (
+	//go:embed blocklist.txt
+	defaultBlocklist string
+
+	blocked = new(expvar.Int)
+)
+
+func init() {
+	metrics.Set("blocked", blocked)
+}
+
+// leet reads the digits which look like letters as the letters.
+var leet = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b", "9", "g")
+
+// Blocklist is the words the codes must not contain.
+type Blocklist []string
+
+// DefaultBlocklist is the built-in list of offensive words.
+func DefaultBlocklist() Blocklist {
+	list, _ := ReadBlocklist(strings.NewReader(defaultBlocklist))
+	return list
+}
+
+// ReadBlocklist reads a word per line. Empty lines and the ones starting
+// with # are skipped.
+func ReadBlocklist(r io.Reader) (Blocklist, error) {
+	var list Blocklist
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		list = append(list, word)
+	}
+
+	return list, scanner.Err()
+}
+
+// Blocks tells whether the code contains one of the words, in any case and
+// with 1 read both as i and as l.
+func (b Blocklist) Blocks(code string) bool {
+	code = leet.Replace(strings.ToLower(code))
+	alt := strings.ReplaceAll(code, "i", "l")
+
+	for _, word := range b {
+		if strings.Contains(code, word) || strings.Contains(alt, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Filtered asks its generator for other codes of the same ID while a code
+// contains a blocked word. The IDs based generators make a random code for
+// a retry, so the next one is as likely to be blocked as any.
+type Filtered struct {
+	gen       Generator
+	blocklist Blocklist
+}
+
+func NewFiltered(gen Generator, blocklist Blocklist) *Filtered {
+	return &Filtered{gen: gen, blocklist: blocklist}
+}
+
+func (g *Filtered) Generate(id, attempt int) string {
+	code := g.gen.Generate(id, attempt)
+	for i := 1; i < FilterAttempts && g.blocklist.Blocks(code); i++ {
+		blocked.Add(1)
+		code = g.gen.Generate(id, attempt+i)
+	}
+
+	return code
+}
@@ -0,0 +1,103 @@
+package shortcode
+
+import (
+	"expvar"
+	"math"
+	"sync"
+)
+
+// metrics are published with expvar under "shortcode": the codes generated,
+// the ones of them which had collided, and the length of the codes made now.
+var (
+	metrics    = expvar.NewMap("shortcode")
+	generated  = new(expvar.Int)
+	collisions = new(expvar.Int)
+	length     = new(expvar.Int)
+)
+
+func init() {
+	metrics.Set("generated", generated)
+	metrics.Set("collisions", collisions)
+	metrics.Set("length", length)
+}
+
+// Growing makes codes with a generator of the current length and moves to a
+// longer one as the keyspace fills: once more than threshold of the codes
+// of a window have been retries after a collision. The codes made before
+// stay as they are, and are never taken by the longer ones. The length is
+// not kept, Seed starts it from the number of codes there are.
+type Growing struct {
+	newGen    func(length int) Generator
+	threshold float64
+	window    int
+
+	mu         sync.Mutex
+	gen        Generator
+	length     int
+	generated  int
+	collisions int
+}
+
+func NewGrowing(newGen func(length int) Generator, initial int, threshold float64, window int) *Growing {
+	length.Set(int64(initial))
+
+	return &Growing{
+		newGen:    newGen,
+		threshold: threshold,
+		window:    window,
+		gen:       newGen(initial),
+		length:    initial,
+	}
+}
+
+// Length is the length of the codes made now.
+func (g *Growing) Length() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.length
+}
+
+// Seed grows the length until count codes of the alphabet would make less
+// than the threshold of the new ones collide.
+func (g *Growing) Seed(count int, alphabet Alphabet) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.threshold <= 0 || len(alphabet) < 2 {
+		return
+	}
+
+	grown := g.length
+	for float64(count) > g.threshold*math.Pow(float64(len(alphabet)), float64(grown)) {
+		grown++
+	}
+	if grown != g.length {
+		g.length = grown
+		g.gen = g.newGen(grown)
+		length.Set(int64(grown))
+	}
+}
+
+func (g *Growing) Generate(id, attempt int) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.generated++
+	generated.Add(1)
+	if attempt > 0 {
+		g.collisions++
+		collisions.Add(1)
+	}
+
+	if g.generated >= g.window {
+		if float64(g.collisions)/float64(g.generated) > g.threshold {
+			g.length++
+			g.gen = g.newGen(g.length)
+			length.Set(int64(g.length))
+		}
+		g.generated, g.collisions = 0, 0
+	}
+
+	return g.gen.Generate(id, attempt)
+}
@@ -0,0 +1,171 @@
+// Package shortcode makes the short codes of the links.
+package shortcode
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/iryzzh/practicum-go-shortener/internal/pkg/utils"
+	"hash/fnv"
+	"math/bits"
+)
+
+// DefaultLength is the length of the codes when nothing else is asked for.
+const DefaultLength = 8
+
+// Generator makes the code of a url. id is the ID the url is going to be
+// stored under and attempt counts the codes of this url which have turned out
+// to be taken already, so a generator can tell a retry from the first try.
+type Generator interface {
+	Generate(id, attempt int) string
+}
+
+// New returns the generator of the given kind: random, crypto, sequential or
+// obfuscated. salt only matters to obfuscated.
+func New(kind string, length int, alphabet Alphabet, salt string) (Generator, error) {
+	newGen, err := Factory(kind, alphabet, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return newGen(length), nil
+}
+
+// Factory returns what makes the generators of the given kind by length, as
+// Growing needs.
+func Factory(kind string, alphabet Alphabet, salt string) (func(length int) Generator, error) {
+	switch kind {
+	case "", "random":
+		return func(length int) Generator { return NewRandom(length, alphabet) }, nil
+	case "crypto":
+		return func(length int) Generator { return NewCryptoRandom(length, alphabet) }, nil
+	case "sequential":
+		return func(length int) Generator { return NewSequential(length, alphabet) }, nil
+	case "obfuscated":
+		return func(length int) Generator { return NewObfuscated(length, alphabet, salt) }, nil
+	default:
+		return nil, fmt.Errorf("unknown short code generator: %s", kind)
+	}
+}
+
+// Random makes codes of math/rand characters of the alphabet.
+type Random struct {
+	Length   int
+	Alphabet Alphabet
+}
+
+func NewRandom(length int, alphabet Alphabet) *Random {
+	return &Random{Length: length, Alphabet: alphabet}
+}
+
+func (g *Random) Generate(id, attempt int) string {
+	return utils.RandStringFrom(g.Length, string(g.Alphabet))
+}
+
+// CryptoRandom makes codes like Random from crypto/rand, so that they can
+// not be predicted from the ones seen before.
+type CryptoRandom struct {
+	Length   int
+	Alphabet Alphabet
+}
+
+func NewCryptoRandom(length int, alphabet Alphabet) *CryptoRandom {
+	return &CryptoRandom{Length: length, Alphabet: alphabet}
+}
+
+func (g *CryptoRandom) Generate(id, attempt int) string {
+	base := g.Alphabet.base()
+	b := make([]byte, g.Length)
+	buf := make([]byte, g.Length)
+
+	for i := 0; i < len(b); {
+		if _, err := rand.Read(buf); err != nil {
+			panic(err)
+		}
+		for _, c := range buf {
+			if i == len(b) {
+				break
+			}
+			// the bytes past the last multiple of the alphabet size would
+			// make the first characters more likely
+			if uint64(c) >= 256/base*base {
+				continue
+			}
+			b[i] = g.Alphabet[uint64(c)%base]
+			i++
+		}
+	}
+
+	return string(b)
+}
+
+// Sequential encodes the ID with the alphabet as digits, padded to Length.
+// Codes of different urls never collide, a taken one can only be an alias.
+type Sequential struct {
+	Length   int
+	Alphabet Alphabet
+}
+
+func NewSequential(length int, alphabet Alphabet) *Sequential {
+	return &Sequential{Length: length, Alphabet: alphabet}
+}
+
+func (g *Sequential) Generate(id, attempt int) string {
+	return retry(g.Alphabet, g.Alphabet.encode(uint64(id), g.Length), attempt)
+}
+
+// Obfuscated works like Sequential with the IDs scattered over the codes of
+// the same length: the ID is multiplied by a key coprime to the number of
+// codes and shifted, both derived from the salt. That is a permutation of
+// the codes, so they do not collide either.
+type Obfuscated struct {
+	Length   int
+	Alphabet Alphabet
+
+	mul, add uint64
+}
+
+func NewObfuscated(length int, alphabet Alphabet, salt string) *Obfuscated {
+	h := fnv.New64a()
+	h.Write([]byte(salt))
+	mul := h.Sum64() | 1
+	for gcd(mul, alphabet.base()) != 1 {
+		mul += 2
+	}
+	h.Write([]byte{0})
+
+	return &Obfuscated{Length: length, Alphabet: alphabet, mul: mul, add: h.Sum64()}
+}
+
+func (g *Obfuscated) Generate(id, attempt int) string {
+	n := g.Alphabet.digits(uint64(id))
+	if n < g.Length {
+		n = g.Length
+	}
+	if n > g.Alphabet.maxDigits() {
+		return retry(g.Alphabet, g.Alphabet.encode(uint64(id), n), attempt)
+	}
+
+	m := g.Alphabet.pow(n)
+	hi, lo := bits.Mul64(uint64(id), g.mul)
+	v := (bits.Rem64(hi, lo, m) + g.add%m) % m
+
+	return retry(g.Alphabet, g.Alphabet.encode(v, n), attempt)
+}
+
+// retry replaces the code of an ID which is taken, by an alias or as a
+// blocked word, with a random one a character longer.
+func retry(alphabet Alphabet, code string, attempt int) string {
+	if attempt == 0 {
+		return code
+	}
+
+	return utils.RandStringFrom(len(code)+1, string(alphabet))
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
@@ -0,0 +1,209 @@
+package shortcode_test
+
+import (
+	"expvar"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/shortcode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var reCode = regexp.MustCompile(`^[0-9a-zA-Z]+$`)
+
+func TestNew(t *testing.T) {
+	for _, kind := range []string{"", "random", "crypto", "sequential", "obfuscated"} {
+		g, err := shortcode.New(kind, 8, shortcode.Base62, "salt")
+		require.NoError(t, err, kind)
+
+		code := g.Generate(1, 0)
+		assert.Len(t, code, 8, kind)
+		assert.Regexp(t, reCode, code, kind)
+	}
+
+	_, err := shortcode.New("unknown", 8, shortcode.Base62, "")
+	assert.Error(t, err)
+}
+
+func TestSequential(t *testing.T) {
+	g := shortcode.NewSequential(4, shortcode.Base62)
+
+	assert.Equal(t, "0001", g.Generate(1, 0))
+	assert.Equal(t, "000Z", g.Generate(61, 0))
+	assert.Equal(t, "0010", g.Generate(62, 0))
+	assert.Equal(t, "10000", g.Generate(62*62*62*62, 0))
+	// a retry gets a random code a character longer
+	assert.Len(t, g.Generate(1, 1), 5)
+	assert.NotEqual(t, "0001", g.Generate(1, 1)[:4])
+}
+
+func TestObfuscated(t *testing.T) {
+	g := shortcode.NewObfuscated(2, shortcode.Base62, "salt")
+
+	// every ID up to the number of codes of the length gets its own code
+	seen := make(map[string]int)
+	for id := 0; id < 62*62; id++ {
+		code := g.Generate(id, 0)
+		require.Len(t, code, 2)
+		require.NotContains(t, seen, code, "ids %d and %d", seen[code], id)
+		seen[code] = id
+	}
+
+	// and longer codes past it
+	assert.Len(t, g.Generate(62*62, 0), 3)
+
+	assert.NotEqual(t, g.Generate(1, 0), shortcode.NewObfuscated(2, shortcode.Base62, "other").Generate(1, 0))
+	assert.Equal(t, g.Generate(1, 0), shortcode.NewObfuscated(2, shortcode.Base62, "salt").Generate(1, 0))
+	assert.NotEqual(t, g.Generate(1, 0), g.Generate(1, 1))
+}
+
+func TestAlphabet(t *testing.T) {
+	for _, name := range []string{"", "base62", "crockford", "lowercase", "unambiguous"} {
+		alphabet, err := shortcode.ParseAlphabet(name)
+		require.NoError(t, err, name)
+
+		for _, kind := range []string{"random", "crypto", "sequential", "obfuscated"} {
+			g, err := shortcode.New(kind, 6, alphabet, "salt")
+			require.NoError(t, err)
+
+			for id := 1; id < 100; id++ {
+				code := g.Generate(id, id%2)
+				for _, c := range code {
+					require.Contains(t, string(alphabet), string(c), "%s %s %s", name, kind, code)
+				}
+			}
+		}
+	}
+
+	_, err := shortcode.ParseAlphabet("unknown")
+	assert.Error(t, err)
+
+	g := shortcode.NewSequential(2, shortcode.Crockford)
+	assert.Equal(t, "0z", g.Generate(31, 0))
+	assert.Equal(t, "10", g.Generate(32, 0))
+
+	// the obfuscated codes are a permutation for any alphabet size
+	g2 := shortcode.NewObfuscated(2, shortcode.Unambiguous, "salt")
+	seen := make(map[string]bool)
+	for id := 0; id < len(shortcode.Unambiguous)*len(shortcode.Unambiguous); id++ {
+		code := g2.Generate(id, 0)
+		require.False(t, seen[code], code)
+		seen[code] = true
+	}
+}
+
+func TestBlocklist(t *testing.T) {
+	list := shortcode.DefaultBlocklist()
+	require.NotEmpty(t, list)
+
+	assert.True(t, list.Blocks("xxFUCKxx"))
+	assert.True(t, list.Blocks("a5sh0le"))
+	assert.True(t, list.Blocks("sh1t"))
+	assert.False(t, list.Blocks("k7x2mq9z"))
+
+	list, err := shortcode.ReadBlocklist(strings.NewReader("# comment\n\nBad\n"))
+	require.NoError(t, err)
+	assert.Equal(t, shortcode.Blocklist{"bad"}, list)
+	assert.True(t, list.Blocks("xbadx"))
+	assert.True(t, list.Blocks("84d"))
+}
+
+func TestFiltered(t *testing.T) {
+	// "0001" reads as "oooi", the code of 1 is blocked and a retry is taken
+	g := shortcode.NewFiltered(shortcode.NewSequential(4, shortcode.Base62), shortcode.Blocklist{"oi"})
+	metrics := expvar.Get("shortcode").(*expvar.Map)
+	blocked := metrics.Get("blocked").(*expvar.Int).Value()
+
+	assert.Equal(t, "0002", g.Generate(2, 0))
+	assert.Len(t, g.Generate(1, 0), 5)
+	assert.GreaterOrEqual(t, metrics.Get("blocked").(*expvar.Int).Value(), blocked+1)
+}
+
+func TestCryptoRandom(t *testing.T) {
+	g := shortcode.NewCryptoRandom(16, shortcode.Base62)
+
+	assert.NotEqual(t, g.Generate(1, 0), g.Generate(1, 0))
+	assert.Len(t, g.Generate(1, 0), 16)
+}
+
+func TestGrowing(t *testing.T) {
+	g := shortcode.NewGrowing(func(length int) shortcode.Generator {
+		return shortcode.NewSequential(length, shortcode.Base62)
+	}, 4, 0.2, 10)
+	metrics := expvar.Get("shortcode").(*expvar.Map)
+	collisions := metrics.Get("collisions").(*expvar.Int).Value()
+
+	// one retry in ten stays below the threshold
+	for i := 0; i < 9; i++ {
+		g.Generate(i+1, 0)
+	}
+	g.Generate(9, 1)
+	assert.Equal(t, 4, g.Length())
+	assert.Len(t, g.Generate(1, 0), 4)
+
+	// every other code colliding is past it
+	for i := 0; i < 10; i++ {
+		g.Generate(i+1, i%2)
+	}
+	assert.Equal(t, 5, g.Length())
+	assert.Len(t, g.Generate(1, 0), 5)
+
+	assert.Equal(t, collisions+6, metrics.Get("collisions").(*expvar.Int).Value())
+	assert.Equal(t, "5", metrics.Get("length").String())
+}
+
+func TestGrowingSeed(t *testing.T) {
+	g := shortcode.NewGrowing(func(length int) shortcode.Generator {
+		return shortcode.NewSequential(length, shortcode.Base62)
+	}, 2, 0.01, 10)
+
+	// 3844 codes of two characters, 38 of them are below 1%
+	g.Seed(38, shortcode.Base62)
+	assert.Equal(t, 2, g.Length())
+
+	g.Seed(39, shortcode.Base62)
+	assert.Equal(t, 3, g.Length())
+	assert.Len(t, g.Generate(1, 0), 3)
+
+	g.Seed(1000000, shortcode.Base62)
+	assert.Equal(t, 5, g.Length())
+
+	// it never shrinks
+	g.Seed(0, shortcode.Base62)
+	assert.Equal(t, 5, g.Length())
+}
+
+func TestChecked(t *testing.T) {
+	g := shortcode.NewChecked(shortcode.NewSequential(4, shortcode.Crockford), shortcode.Crockford)
+
+	code := g.Generate(1234, 0)
+	require.Len(t, code, 5)
+	assert.True(t, shortcode.Crockford.Valid(code))
+	assert.False(t, shortcode.Crockford.Valid(code[:4]))
+	assert.False(t, shortcode.Crockford.Valid("x"))
+	assert.False(t, shortcode.Crockford.Valid("ilou0"))
+
+	// every single mistyped character is caught and corrected
+	for i := range code {
+		for _, c := range shortcode.Crockford {
+			if byte(c) == code[i] {
+				continue
+			}
+			typo := code[:i] + string(c) + code[i+1:]
+			require.False(t, shortcode.Crockford.Valid(typo), typo)
+			assert.Contains(t, shortcode.Crockford.Corrections(typo), code, typo)
+		}
+	}
+
+	// as are a character left out and two swapped
+	assert.Contains(t, shortcode.Crockford.Corrections(code[1:]), code)
+	swapped := code[:1] + code[2:3] + code[1:2] + code[3:]
+	if swapped != code && !shortcode.Crockford.Valid(swapped) {
+		assert.Contains(t, shortcode.Crockford.Corrections(swapped), code)
+	}
+
+	for _, c := range shortcode.Crockford.Corrections(code[1:]) {
+		assert.True(t, shortcode.Crockford.Valid(c), c)
+	}
+}
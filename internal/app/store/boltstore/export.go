@@ -0,0 +1,117 @@
+package boltstore
+
+import (
+	"context"
+	"fmt"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"go.etcd.io/bbolt"
+)
+
+// ExportUsers calls fn inside a read-only transaction, which sees the store
+// as it was when the export started and does not hold writers back.
+func (s *Store) ExportUsers(ctx context.Context, fn func(user *model.User) error) error {
+	return s.view(ctx, func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketUsers).ForEach(func(k, v []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var user model.User
+			if err := json.Unmarshal(v, &user); err != nil {
+				return fmt.Errorf("user %d: %w", btoi(k), err)
+			}
+
+			return fn(&user)
+		})
+	})
+}
+
+// ExportURLs works like ExportUsers.
+func (s *Store) ExportURLs(ctx context.Context, fn func(url *model.URL) error) error {
+	return s.view(ctx, func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketURLs).ForEach(func(k, v []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var url model.URL
+			if err := json.Unmarshal(v, &url); err != nil {
+				return fmt.Errorf("url %d: %w", btoi(k), err)
+			}
+
+			return fn(&url)
+		})
+	})
+}
+
+// ImportUsers stores the batch in one transaction and moves the bucket
+// sequence past the imported IDs.
+func (s *Store) ImportUsers(ctx context.Context, users []*model.User) error {
+	return s.update(ctx, func(tx *bbolt.Tx) error {
+		for _, user := range users {
+			if id := tx.Bucket(bucketUsersByUUID).Get([]byte(user.UUID)); id != nil && btoi(id) != user.ID {
+				return fmt.Errorf("user %d: uuid %s belongs to user %d", user.ID, user.UUID, btoi(id))
+			}
+
+			if err := putUser(tx, *user); err != nil {
+				return err
+			}
+			if err := raise(tx.Bucket(bucketUsers), user.ID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ImportURLs works like ImportUsers.
+func (s *Store) ImportURLs(ctx context.Context, urls []*model.URL) error {
+	return s.update(ctx, func(tx *bbolt.Tx) error {
+		for _, url := range urls {
+			if id := tx.Bucket(bucketURLsByOrigin).Get([]byte(s.Dedup.Key(url))); id != nil && btoi(id) != url.ID {
+				return fmt.Errorf("url %d: %w: %s belongs to url %d", url.ID, store.ErrURLExist, url.URLOrigin, btoi(id))
+			}
+			if id := tx.Bucket(bucketURLsByShort).Get([]byte(url.URLShort)); id != nil && btoi(id) != url.ID {
+				return fmt.Errorf("url %d: short code %s belongs to url %d", url.ID, url.URLShort, btoi(id))
+			}
+
+			if err := s.putURL(tx, *url); err != nil {
+				return err
+			}
+			if err := raise(tx.Bucket(bucketURLs), url.ID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *Store) LastURLID(ctx context.Context) (int, error) {
+	var id int
+
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		id = int(tx.Bucket(bucketURLs).Sequence())
+		return nil
+	})
+
+	return id, err
+}
+
+func (s *Store) RaiseURLID(ctx context.Context, id int) error {
+	return s.update(ctx, func(tx *bbolt.Tx) error {
+		return raise(tx.Bucket(bucketURLs), id)
+	})
+}
+
+// raise moves the sequence of b up to id so that new records come after
+// the imported ones.
+func raise(b *bbolt.Bucket, id int) error {
+	if b.Sequence() >= uint64(id) {
+		return nil
+	}
+
+	return b.SetSequence(uint64(id))
+}
@@ -0,0 +1,32 @@
+package boltstore
+
+import (
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"time"
+)
+
+type Option func(*Store)
+
+// WithTimeout sets how long New waits for the file lock held by another
+// process, one second by default. Zero waits forever.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Store) {
+		s.timeout = timeout
+	}
+}
+
+// WithNoSync skips fsync after each commit. Faster, but a crash may lose
+// the last transactions; meant for tests and bulk loads.
+func WithNoSync() Option {
+	return func(s *Store) {
+		s.noSync = true
+	}
+}
+
+// WithOptions sets the store.Options. A file written with another dedup
+// scope has its urls_by_origin bucket rebuilt when it is opened.
+func WithOptions(o store.Options) Option {
+	return func(s *Store) {
+		s.Options = o
+	}
+}
@@ -0,0 +1,231 @@
+package boltstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/json-iterator/go"
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+	"strconv"
+	"time"
+)
+
+var (
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	// urls and users keep the records by ID, the other buckets map a key
+	// to the ID of its record. urlsByUser keys are the owner ID followed by
+	// the url ID, so a prefix scan lists the urls of a user in ID order.
+	// urlsByExpiry keys are the expiry followed by the url ID, only the urls
+	// which are not deleted yet are there. urlsByDeleted keys are the time of
+	// deletion, zero when it is not known, followed by the url ID, only the
+	// deleted urls are there. urlsByOrigin keys are the store.Dedup keys of
+	// the urls, meta keeps the scope they have been written for.
+	bucketURLs          = []byte("urls")
+	bucketURLsByShort   = []byte("urls_by_short")
+	bucketURLsByOrigin  = []byte("urls_by_origin")
+	bucketURLsByUser    = []byte("urls_by_user")
+	bucketURLsByExpiry  = []byte("urls_by_expiry")
+	bucketURLsByDeleted = []byte("urls_by_deleted")
+	bucketUsers         = []byte("users")
+	bucketUsersByUUID   = []byte("users_by_uuid")
+	bucketMeta          = []byte("meta")
+
+	keyDedup = []byte("dedup")
+
+	buckets = [][]byte{
+		bucketURLs,
+		bucketURLsByShort,
+		bucketURLsByOrigin,
+		bucketURLsByUser,
+		bucketURLsByExpiry,
+		bucketURLsByDeleted,
+		bucketUsers,
+		bucketUsersByUUID,
+		bucketMeta,
+	}
+)
+
+// Store keeps the data in a single bbolt file. Every change is a bbolt
+// transaction, which is on disk once it has returned, and every lookup goes
+// through an index bucket, so nothing is read into memory on startup.
+type Store struct {
+	db      *bbolt.DB
+	tx      *bbolt.Tx
+	timeout time.Duration
+	noSync  bool
+	store.Options
+}
+
+// New opens the file at path, creating it if needed. bbolt locks the file,
+// a second process waits for the lock as long as WithTimeout allows.
+func New(path string, opts ...Option) (*Store, error) {
+	s := &Store{
+		timeout: time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Options.Init()
+
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{
+		Timeout: s.timeout,
+		NoSync:  s.noSync,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.db = db
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range buckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return errors.Wrapf(err, "create bucket %s", name)
+			}
+		}
+
+		return s.checkDedup(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// checkDedup rebuilds urls_by_origin when the file has been written for
+// another dedup scope. Of the urls which turn out to be the same in the new
+// scope the first one is kept in the index. A file without the scope has
+// been written for store.DedupGlobal.
+func (s *Store) checkDedup(tx *bbolt.Tx) error {
+	meta := tx.Bucket(bucketMeta)
+	current := []byte(strconv.Itoa(int(s.Dedup)))
+
+	written := meta.Get(keyDedup)
+	if written == nil {
+		written = []byte(strconv.Itoa(int(store.DedupGlobal)))
+	}
+	if bytes.Equal(written, current) {
+		return meta.Put(keyDedup, current)
+	}
+
+	if err := tx.DeleteBucket(bucketURLsByOrigin); err != nil {
+		return err
+	}
+	origins, err := tx.CreateBucket(bucketURLsByOrigin)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Bucket(bucketURLs).ForEach(func(k, v []byte) error {
+		var url model.URL
+		if err := json.Unmarshal(v, &url); err != nil {
+			return fmt.Errorf("url %d: %w", btoi(k), err)
+		}
+
+		key := []byte(s.Dedup.Key(&url))
+		if origins.Get(key) != nil {
+			return nil
+		}
+		return origins.Put(key, k)
+	})
+	if err != nil {
+		return err
+	}
+
+	return meta.Put(keyDedup, current)
+}
+
+func (s *Store) Close() error {
+	if s.tx != nil {
+		return nil
+	}
+
+	return s.db.Close()
+}
+
+func (s *Store) WithTx(ctx context.Context, fn func(tx store.Store) error) error {
+	return s.update(ctx, func(tx *bbolt.Tx) error {
+		return fn(&Store{db: s.db, tx: tx, Options: s.Options})
+	})
+}
+
+// view runs fn in a read-only transaction, or in the running one when s is
+// bound to a transaction.
+func (s *Store) view(ctx context.Context, fn func(tx *bbolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+
+	return s.db.View(fn)
+}
+
+// update works like view with a writable transaction. The changes are kept
+// if fn returns nil.
+func (s *Store) update(ctx context.Context, fn func(tx *bbolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+
+	return s.db.Update(fn)
+}
+
+func (s *Store) URL() store.URLRepository {
+	return &URLRepository{store: s}
+}
+
+func (s *Store) User() store.UserRepository {
+	return &UserRepository{store: s}
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return s.view(ctx, func(tx *bbolt.Tx) error {
+		return nil
+	})
+}
+
+// itob encodes an ID as a big-endian key, so that keys sort by ID.
+func itob(id int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+
+	return b
+}
+
+func btoi(b []byte) int {
+	return int(binary.BigEndian.Uint64(b))
+}
+
+// userKey is the key of a url in the urls_by_user bucket.
+func userKey(userID, urlID int) []byte {
+	return append(itob(userID), itob(urlID)...)
+}
+
+// deletedKey is the key of a url in the urls_by_deleted bucket.
+func deletedKey(deletedAt *time.Time, urlID int) []byte {
+	var at int
+	if deletedAt != nil {
+		at = int(deletedAt.UnixMicro())
+	}
+
+	return append(itob(at), itob(urlID)...)
+}
+
+// expiryKey is the key of a url in the urls_by_expiry bucket.
+func expiryKey(expiresAt time.Time, urlID int) []byte {
+	return append(itob(int(expiresAt.UnixMicro())), itob(urlID)...)
+}
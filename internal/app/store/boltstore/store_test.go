@@ -0,0 +1,117 @@
+package boltstore_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/shortcode"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/boltstore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return boltstore.TestStore(t)
+	})
+}
+
+func TestStoreDedupUser(t *testing.T) {
+	storetest.RunDedupUser(t, func(t *testing.T) store.Store {
+		return boltstore.TestStore(t, boltstore.WithOptions(store.Options{Dedup: store.DedupUser}))
+	})
+}
+
+func TestStoreGenerator(t *testing.T) {
+	storetest.RunGenerator(t, func(t *testing.T, gen shortcode.Generator) store.Store {
+		return boltstore.TestStore(t, boltstore.WithOptions(store.Options{Generator: gen}))
+	})
+}
+
+func TestStoreCaseInsensitive(t *testing.T) {
+	storetest.RunCaseInsensitive(t, func(t *testing.T, gen shortcode.Generator) store.Store {
+		return boltstore.TestStore(t, boltstore.WithOptions(store.Options{Generator: gen, Case: store.CaseInsensitive}))
+	})
+}
+
+func TestStoreReopen(t *testing.T) {
+	path := t.TempDir() + "/store.db"
+	ctx := context.Background()
+
+	st, err := boltstore.New(path)
+	require.NoError(t, err)
+
+	user := &model.User{UUID: uuid.New().String()}
+	require.NoError(t, st.User().Create(ctx, user))
+
+	url := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(ctx, url))
+	require.NoError(t, st.URL().UpdateUserID(ctx, url, user.ID))
+	require.NoError(t, st.URL().Delete(ctx, url))
+
+	// the file is locked while the store is open
+	_, err = boltstore.New(path, boltstore.WithTimeout(10*time.Millisecond))
+	assert.Error(t, err)
+
+	require.NoError(t, st.Close())
+
+	st, err = boltstore.New(path)
+	require.NoError(t, err)
+	defer st.Close()
+
+	u, err := st.URL().FindByUUID(ctx, url.URLShort)
+	require.NoError(t, err)
+	assert.Equal(t, url.ID, u.ID)
+	assert.Equal(t, user.ID, u.UserID)
+	assert.True(t, u.IsDeleted)
+
+	found, err := st.User().FindByUUID(ctx, user.UUID)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, found.ID)
+
+	next := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(ctx, next))
+	assert.Greater(t, next.ID, url.ID)
+}
+
+func TestStoreDedupChange(t *testing.T) {
+	path := t.TempDir() + "/store.db"
+	ctx := context.Background()
+
+	st, err := boltstore.New(path, boltstore.WithOptions(store.Options{Dedup: store.DedupUser}))
+	require.NoError(t, err)
+
+	origin := model.TestURLGenerated(t).URLOrigin
+	urls := make([]*model.URL, 2)
+	for i := range urls {
+		urls[i] = model.TestURLGenerated(t)
+		urls[i].URLOrigin = origin
+		urls[i].UserID = i + 1
+		require.NoError(t, st.URL().Create(ctx, urls[i]))
+	}
+	require.NoError(t, st.Close())
+
+	// the first of the urls which are the same now is found
+	st, err = boltstore.New(path)
+	require.NoError(t, err)
+
+	url := model.TestURLGenerated(t)
+	url.URLOrigin = origin
+	require.ErrorIs(t, st.URL().Create(ctx, url), store.ErrURLExist)
+	assert.Equal(t, urls[0].ID, url.ID)
+	require.NoError(t, st.Close())
+
+	st, err = boltstore.New(path, boltstore.WithOptions(store.Options{Dedup: store.DedupUser}))
+	require.NoError(t, err)
+	defer st.Close()
+
+	url = model.TestURLGenerated(t)
+	url.URLOrigin = origin
+	url.UserID = urls[1].UserID
+	require.ErrorIs(t, st.URL().Create(ctx, url), store.ErrURLExist)
+	assert.Equal(t, urls[1].ID, url.ID)
+}
@@ -0,0 +1,20 @@
+package boltstore
+
+import "testing"
+
+// TestStore opens a store in a temporary directory, it is closed when the
+// test finishes.
+func TestStore(t *testing.T, opts ...Option) *Store {
+	t.Helper()
+
+	s, err := New(t.TempDir()+"/test.db", append([]Option{WithNoSync()}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		s.Close()
+	})
+
+	return s
+}
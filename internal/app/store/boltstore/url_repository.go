@@ -0,0 +1,469 @@
+package boltstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"go.etcd.io/bbolt"
+	"sort"
+	"time"
+)
+
+type URLRepository struct {
+	store *Store
+}
+
+func (r *URLRepository) IsDeleted(ctx context.Context, id int) bool {
+	url, err := r.FindByID(ctx, id)
+
+	return err == nil && url.IsDeleted
+}
+
+func (r *URLRepository) BatchDelete(ctx context.Context, ids []int) error {
+	return r.store.update(ctx, func(tx *bbolt.Tx) error {
+		now := model.Now()
+		for _, id := range ids {
+			url, ok, err := getURL(tx, id)
+			if err != nil {
+				return err
+			}
+			if !ok || url.IsDeleted {
+				continue
+			}
+
+			url.IsDeleted = true
+			url.DeletedAt = now
+			if err := r.store.putURL(tx, url); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeleteExpired reads urls_by_expiry from the start up to now.
+func (r *URLRepository) DeleteExpired(ctx context.Context, now time.Time) ([]int, error) {
+	var ids []int
+
+	err := r.store.update(ctx, func(tx *bbolt.Tx) error {
+		end := itob(int(now.UnixMicro()))
+		c := tx.Bucket(bucketURLsByExpiry).Cursor()
+
+		// the keys are collected first, putURL changes the bucket
+		for k, _ := c.First(); k != nil && bytes.Compare(k[:len(end)], end) <= 0; k, _ = c.Next() {
+			ids = append(ids, btoi(k[len(end):]))
+		}
+
+		for _, id := range ids {
+			url, ok, err := getURL(tx, id)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+
+			url.IsDeleted = true
+			url.DeletedAt = model.Timestamp(&now)
+			if err := r.store.putURL(tx, url); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Ints(ids)
+
+	return ids, nil
+}
+
+func (r *URLRepository) Purge(ctx context.Context, ids []int) error {
+	return r.store.update(ctx, func(tx *bbolt.Tx) error {
+		for _, id := range ids {
+			url, ok, err := getURL(tx, id)
+			if err != nil {
+				return err
+			}
+			if !ok || !url.IsDeleted {
+				continue
+			}
+
+			if err := r.store.purgeURL(tx, url); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// PurgeDeleted reads urls_by_deleted from the start up to before, the urls
+// deleted at an unknown time come first.
+func (r *URLRepository) PurgeDeleted(ctx context.Context, before time.Time) ([]int, error) {
+	var ids []int
+
+	err := r.store.update(ctx, func(tx *bbolt.Tx) error {
+		end := itob(int(before.UnixMicro()))
+		c := tx.Bucket(bucketURLsByDeleted).Cursor()
+
+		for k, _ := c.First(); k != nil && bytes.Compare(k[:len(end)], end) <= 0; k, _ = c.Next() {
+			ids = append(ids, btoi(k[len(end):]))
+		}
+
+		for _, id := range ids {
+			url, ok, err := getURL(tx, id)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+
+			if err := r.store.purgeURL(tx, url); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Ints(ids)
+
+	return ids, nil
+}
+
+func (r *URLRepository) Delete(ctx context.Context, url *model.URL) error {
+	return r.store.update(ctx, func(tx *bbolt.Tx) error {
+		v, ok, err := getURL(tx, url.ID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return store.ErrRecordNotFound
+		}
+		if v.IsDeleted {
+			return nil
+		}
+
+		v.IsDeleted = true
+		v.DeletedAt = model.Now()
+
+		return r.store.putURL(tx, v)
+	})
+}
+
+func (r *URLRepository) Create(ctx context.Context, url *model.URL) error {
+	if err := url.Validate(r.store.MaxURLLength); err != nil {
+		return err
+	}
+	r.store.Case.FoldAll(url)
+
+	v := *url
+	created := false
+
+	err := r.store.update(ctx, func(tx *bbolt.Tx) error {
+		var err error
+		created, err = r.store.createURL(tx, &v)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	*url = v
+	if !created {
+		return store.ErrURLExist
+	}
+
+	return nil
+}
+
+// BatchCreate stores the batch in a single transaction. A url repeated in
+// the batch is found in the index by its second occurrence.
+func (r *URLRepository) BatchCreate(ctx context.Context, urls []*model.URL) ([]bool, error) {
+	for _, url := range urls {
+		if err := url.Validate(r.store.MaxURLLength); err != nil {
+			return nil, err
+		}
+	}
+	r.store.Case.FoldAll(urls...)
+
+	created := make([]bool, len(urls))
+	result := make([]model.URL, len(urls))
+
+	err := r.store.update(ctx, func(tx *bbolt.Tx) error {
+		for i, url := range urls {
+			result[i] = *url
+
+			var err error
+			if created[i], err = r.store.createURL(tx, &result[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, url := range urls {
+		*url = result[i]
+	}
+
+	return created, nil
+}
+
+func (r *URLRepository) FindByID(ctx context.Context, id int) (*model.URL, error) {
+	var url model.URL
+
+	err := r.store.view(ctx, func(tx *bbolt.Tx) error {
+		var (
+			ok  bool
+			err error
+		)
+		url, ok, err = getURL(tx, id)
+		if err == nil && !ok {
+			err = store.ErrRecordNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &url, nil
+}
+
+func (r *URLRepository) FindByUUID(ctx context.Context, uuid string) (*model.URL, error) {
+	return r.store.Case.Find(uuid, func(short string) (*model.URL, error) {
+		return r.findByUUID(ctx, short)
+	})
+}
+
+func (r *URLRepository) findByUUID(ctx context.Context, uuid string) (*model.URL, error) {
+	var url model.URL
+
+	err := r.store.view(ctx, func(tx *bbolt.Tx) error {
+		id := tx.Bucket(bucketURLsByShort).Get([]byte(uuid))
+		if id == nil {
+			return store.ErrRecordNotFound
+		}
+
+		var (
+			ok  bool
+			err error
+		)
+		url, ok, err = getURL(tx, btoi(id))
+		if err == nil && !ok {
+			err = store.ErrRecordNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &url, nil
+}
+
+// FindByUserID scans the keys of the user in urls_by_user, which come in ID
+// order.
+func (r *URLRepository) FindByUserID(ctx context.Context, id int) ([]*model.URL, error) {
+	var result []*model.URL
+
+	err := r.store.view(ctx, func(tx *bbolt.Tx) error {
+		prefix := itob(id)
+		c := tx.Bucket(bucketURLsByUser).Cursor()
+
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			url, ok, err := getURL(tx, btoi(k[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			if ok {
+				result = append(result, &url)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *URLRepository) FindByUserIDPage(ctx context.Context, id int, q store.URLQuery) ([]*model.URL, error) {
+	urls, err := r.FindByUserID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Page(urls), nil
+}
+
+func (r *URLRepository) UpdateUserID(ctx context.Context, url *model.URL, userID int) error {
+	err := r.store.update(ctx, func(tx *bbolt.Tx) error {
+		v, ok, err := getURL(tx, url.ID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return store.ErrRecordNotFound
+		}
+		if v.UserID == userID {
+			return nil
+		}
+
+		v.UserID = userID
+		if id := tx.Bucket(bucketURLsByOrigin).Get([]byte(r.store.Dedup.Key(&v))); id != nil && btoi(id) != v.ID {
+			return store.ErrURLExist
+		}
+
+		return r.store.putURL(tx, v)
+	})
+	if err != nil {
+		return err
+	}
+
+	url.UserID = userID
+
+	return nil
+}
+
+// createURL stores url under a new ID unless its original URL is there
+// already; then url is set to the stored one and false is returned. A url
+// without a short code gets one from the generator of the store.
+func (s *Store) createURL(tx *bbolt.Tx, url *model.URL) (bool, error) {
+	if id := tx.Bucket(bucketURLsByOrigin).Get([]byte(s.Dedup.Key(url))); id != nil {
+		existing, _, err := getURL(tx, btoi(id))
+		if err != nil {
+			return false, err
+		}
+		*url = existing
+		return false, nil
+	}
+
+	seq, err := tx.Bucket(bucketURLs).NextSequence()
+	if err != nil {
+		return false, err
+	}
+	url.ID = int(seq)
+
+	err = store.Generate(s.Generator, url, func() error {
+		if id := tx.Bucket(bucketURLsByShort).Get([]byte(url.URLShort)); id != nil {
+			return fmt.Errorf("%w: %s belongs to url %d", store.ErrShortExist, url.URLShort, btoi(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, s.putURL(tx, *url)
+}
+
+func getURL(tx *bbolt.Tx, id int) (model.URL, bool, error) {
+	var url model.URL
+
+	data := tx.Bucket(bucketURLs).Get(itob(id))
+	if data == nil {
+		return url, false, nil
+	}
+
+	if err := json.Unmarshal(data, &url); err != nil {
+		return url, false, fmt.Errorf("url %d: %w", id, err)
+	}
+
+	return url, true, nil
+}
+
+// putURL writes the url and moves its index entries from the version it
+// replaces.
+func (s *Store) putURL(tx *bbolt.Tx, url model.URL) error {
+	old, ok, err := getURL(tx, url.ID)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if err := s.deleteURLIndex(tx, old); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(url)
+	if err != nil {
+		return err
+	}
+
+	id := itob(url.ID)
+
+	if err := tx.Bucket(bucketURLs).Put(id, data); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketURLsByShort).Put([]byte(url.URLShort), id); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketURLsByOrigin).Put([]byte(s.Dedup.Key(&url)), id); err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(bucketURLsByUser).Put(userKey(url.UserID, url.ID), []byte{}); err != nil {
+		return err
+	}
+
+	if url.IsDeleted {
+		return tx.Bucket(bucketURLsByDeleted).Put(deletedKey(url.DeletedAt, url.ID), []byte{})
+	}
+
+	if url.ExpiresAt == nil {
+		return nil
+	}
+
+	return tx.Bucket(bucketURLsByExpiry).Put(expiryKey(*url.ExpiresAt, url.ID), []byte{})
+}
+
+func (s *Store) deleteURLIndex(tx *bbolt.Tx, url model.URL) error {
+	if err := tx.Bucket(bucketURLsByShort).Delete([]byte(url.URLShort)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketURLsByOrigin).Delete([]byte(s.Dedup.Key(&url))); err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(bucketURLsByUser).Delete(userKey(url.UserID, url.ID)); err != nil {
+		return err
+	}
+
+	if url.IsDeleted {
+		if err := tx.Bucket(bucketURLsByDeleted).Delete(deletedKey(url.DeletedAt, url.ID)); err != nil {
+			return err
+		}
+	}
+
+	if url.ExpiresAt == nil {
+		return nil
+	}
+
+	return tx.Bucket(bucketURLsByExpiry).Delete(expiryKey(*url.ExpiresAt, url.ID))
+}
+
+// purgeURL removes the url and its index entries. Its ID is not handed out
+// again, the sequence of the bucket only grows.
+func (s *Store) purgeURL(tx *bbolt.Tx, url model.URL) error {
+	if err := s.deleteURLIndex(tx, url); err != nil {
+		return err
+	}
+
+	return tx.Bucket(bucketURLs).Delete(itob(url.ID))
+}
@@ -0,0 +1,110 @@
+package boltstore
+
+import (
+	"context"
+	"fmt"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"go.etcd.io/bbolt"
+)
+
+type UserRepository struct {
+	store *Store
+}
+
+func (r *UserRepository) Create(ctx context.Context, user *model.User) error {
+	return r.store.update(ctx, func(tx *bbolt.Tx) error {
+		if id := tx.Bucket(bucketUsersByUUID).Get([]byte(user.UUID)); id != nil {
+			user.ID = btoi(id)
+			return nil
+		}
+
+		seq, err := tx.Bucket(bucketUsers).NextSequence()
+		if err != nil {
+			return err
+		}
+
+		v := *user
+		v.ID = int(seq)
+		if err := putUser(tx, v); err != nil {
+			return err
+		}
+
+		user.ID = v.ID
+
+		return nil
+	})
+}
+
+func (r *UserRepository) FindByUUID(ctx context.Context, uuid string) (*model.User, error) {
+	var user model.User
+
+	err := r.store.view(ctx, func(tx *bbolt.Tx) error {
+		id := tx.Bucket(bucketUsersByUUID).Get([]byte(uuid))
+		if id == nil {
+			return store.ErrUserNotFound
+		}
+
+		var err error
+		user, err = getUser(tx, btoi(id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (r *UserRepository) FindByID(ctx context.Context, id int) (*model.User, error) {
+	var user model.User
+
+	err := r.store.view(ctx, func(tx *bbolt.Tx) error {
+		var err error
+		user, err = getUser(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func getUser(tx *bbolt.Tx, id int) (model.User, error) {
+	var user model.User
+
+	data := tx.Bucket(bucketUsers).Get(itob(id))
+	if data == nil {
+		return user, store.ErrUserNotFound
+	}
+
+	if err := json.Unmarshal(data, &user); err != nil {
+		return user, fmt.Errorf("user %d: %w", id, err)
+	}
+
+	return user, nil
+}
+
+// putUser writes the user and moves its uuid entry from the version it
+// replaces.
+func putUser(tx *bbolt.Tx, user model.User) error {
+	if old, err := getUser(tx, user.ID); err == nil {
+		if err := tx.Bucket(bucketUsersByUUID).Delete([]byte(old.UUID)); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	id := itob(user.ID)
+
+	if err := tx.Bucket(bucketUsers).Put(id, data); err != nil {
+		return err
+	}
+
+	return tx.Bucket(bucketUsersByUUID).Put([]byte(user.UUID), id)
+}
@@ -0,0 +1,151 @@
+package cachestore
+
+import (
+	"container/list"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"sync"
+	"time"
+)
+
+// entry is a cached lookup of a short code. A nil url remembers that the
+// code is unknown.
+type entry struct {
+	short   string
+	url     *model.URL
+	expires time.Time
+}
+
+// lru keeps at most size entries, the least recently used one is evicted
+// first. Entries found by short code are also indexed by url ID.
+type lru struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	ll      *list.List
+	byShort map[string]*list.Element
+	byID    map[int]*list.Element
+
+	// gen changes with every invalidation, a lookup which started before
+	// it must not be cached
+	gen uint64
+}
+
+func newLRU(size int, ttl time.Duration) *lru {
+	return &lru{
+		size:    size,
+		ttl:     ttl,
+		ll:      list.New(),
+		byShort: make(map[string]*list.Element),
+		byID:    make(map[int]*list.Element),
+	}
+}
+
+// get returns the cached url of short, nil for a code known to be missing.
+// ok is false when there is nothing cached.
+func (c *lru) get(short string) (url *model.URL, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lookup(c.byShort[short])
+}
+
+// getByID works like get for a url that has been found by its short code.
+func (c *lru) getByID(id int) (*model.URL, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lookup(c.byID[id])
+}
+
+func (c *lru) lookup(el *list.Element) (*model.URL, bool) {
+	if el == nil {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if c.ttl > 0 && time.Now().After(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+
+	if e.url == nil {
+		return nil, true
+	}
+	url := *e.url
+
+	return &url, true
+}
+
+// generation is taken before a lookup in the backend and handed to add.
+func (c *lru) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.gen
+}
+
+// add caches the result of a lookup unless something has been invalidated
+// since gen was taken.
+func (c *lru) add(gen uint64, short string, url *model.URL) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+
+	if el, ok := c.byShort[short]; ok {
+		c.remove(el)
+	}
+	if url != nil {
+		if el, ok := c.byID[url.ID]; ok {
+			c.remove(el)
+		}
+		v := *url
+		url = &v
+	}
+
+	e := &entry{
+		short:   short,
+		url:     url,
+		expires: time.Now().Add(c.ttl),
+	}
+	el := c.ll.PushFront(e)
+	c.byShort[short] = el
+	if url != nil {
+		c.byID[url.ID] = el
+	}
+
+	for c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *lru) removeShort(short string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if el, ok := c.byShort[short]; ok {
+		c.remove(el)
+	}
+}
+
+func (c *lru) removeID(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if el, ok := c.byID[id]; ok {
+		c.remove(el)
+	}
+}
+
+func (c *lru) remove(el *list.Element) {
+	e := c.ll.Remove(el).(*entry)
+	delete(c.byShort, e.short)
+	if e.url != nil {
+		delete(c.byID, e.url.ID)
+	}
+}
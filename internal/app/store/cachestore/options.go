@@ -0,0 +1,33 @@
+package cachestore
+
+import (
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"time"
+)
+
+type Option func(*Store)
+
+// WithSize sets how many short codes are kept, 10000 by default.
+func WithSize(size int) Option {
+	return func(s *Store) {
+		if size > 0 {
+			s.size = size
+		}
+	}
+}
+
+// WithTTL sets how long an entry is used, a minute by default. Zero keeps
+// entries until they are evicted or invalidated.
+func WithTTL(ttl time.Duration) Option {
+	return func(s *Store) {
+		s.ttl = ttl
+	}
+}
+
+// WithOptions sets the options the wrapped store is made with. A code typed
+// in another case than Case stores it in is not cached as unknown.
+func WithOptions(o store.Options) Option {
+	return func(s *Store) {
+		s.Options = o
+	}
+}
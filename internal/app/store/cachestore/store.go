@@ -0,0 +1,111 @@
+// Package cachestore puts an LRU cache of short code lookups in front of
+// another store, so that redirects of popular links do not reach it.
+package cachestore
+
+import (
+	"context"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"time"
+)
+
+const (
+	defaultSize = 10000
+	defaultTTL  = time.Minute
+)
+
+// Store caches FindByUUID, including codes which are not there, and
+// IsDeleted of the urls found that way. Everything else goes to the wrapped
+// store; changes made through the cache drop the entries they touch.
+type Store struct {
+	next  store.Store
+	cache *lru
+	size  int
+	ttl   time.Duration
+	store.Options
+
+	// changed is set inside a transaction, see WithTx
+	changed *changes
+}
+
+// changes remembers what a transaction has touched.
+type changes struct {
+	shorts []string
+	ids    []int
+}
+
+func New(next store.Store, opts ...Option) *Store {
+	s := &Store{
+		next: next,
+		size: defaultSize,
+		ttl:  defaultTTL,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.cache = newLRU(s.size, s.ttl)
+
+	return s
+}
+
+func (s *Store) URL() store.URLRepository {
+	return &URLRepository{store: s, next: s.next.URL()}
+}
+
+func (s *Store) User() store.UserRepository {
+	return s.next.User()
+}
+
+// WithTx runs fn in a transaction of the wrapped store. Reads inside it
+// bypass the cache, as they may see changes which are not committed yet.
+// What the transaction has touched is dropped once more when it is over,
+// since other readers could have cached the old values in the meantime.
+func (s *Store) WithTx(ctx context.Context, fn func(tx store.Store) error) error {
+	changed := s.changed
+	if changed == nil {
+		changed = &changes{}
+		defer func() {
+			for _, short := range changed.shorts {
+				s.cache.removeShort(short)
+			}
+			for _, id := range changed.ids {
+				s.cache.removeID(id)
+			}
+		}()
+	}
+
+	return s.next.WithTx(ctx, func(tx store.Store) error {
+		return fn(&Store{
+			next:    tx,
+			cache:   s.cache,
+			size:    s.size,
+			ttl:     s.ttl,
+			Options: s.Options,
+			changed: changed,
+		})
+	})
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return s.next.Ping(ctx)
+}
+
+// Close closes the wrapped store.
+func (s *Store) Close() error {
+	return s.next.Close()
+}
+
+func (s *Store) forgetShort(short string) {
+	s.cache.removeShort(short)
+	if s.changed != nil {
+		s.changed.shorts = append(s.changed.shorts, short)
+	}
+}
+
+func (s *Store) forgetID(id int) {
+	s.cache.removeID(id)
+	if s.changed != nil {
+		s.changed.ids = append(s.changed.ids, id)
+	}
+}
@@ -0,0 +1,147 @@
+package cachestore_test
+
+import (
+	"context"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/cachestore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/memstore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// countingStore counts the lookups which reach the wrapped store.
+type countingStore struct {
+	store.Store
+	lookups int
+}
+
+func (s *countingStore) URL() store.URLRepository {
+	return &countingURLRepository{URLRepository: s.Store.URL(), store: s}
+}
+
+type countingURLRepository struct {
+	store.URLRepository
+	store *countingStore
+}
+
+func (r *countingURLRepository) FindByUUID(ctx context.Context, uuid string) (*model.URL, error) {
+	r.store.lookups++
+	return r.URLRepository.FindByUUID(ctx, uuid)
+}
+
+func (r *countingURLRepository) IsDeleted(ctx context.Context, id int) bool {
+	r.store.lookups++
+	return r.URLRepository.IsDeleted(ctx, id)
+}
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return cachestore.New(memstore.New())
+	})
+}
+
+func TestStoreCache(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStore{Store: memstore.New()}
+	st := cachestore.New(backend)
+
+	url := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(ctx, url))
+
+	for i := 0; i < 3; i++ {
+		u, err := st.URL().FindByUUID(ctx, url.URLShort)
+		require.NoError(t, err)
+		assert.Equal(t, url.URLOrigin, u.URLOrigin)
+		assert.False(t, st.URL().IsDeleted(ctx, u.ID))
+	}
+	assert.Equal(t, 1, backend.lookups)
+
+	// a changed copy does not change the cache
+	u, _ := st.URL().FindByUUID(ctx, url.URLShort)
+	u.URLOrigin = "changed"
+	u, _ = st.URL().FindByUUID(ctx, url.URLShort)
+	assert.Equal(t, url.URLOrigin, u.URLOrigin)
+
+	require.NoError(t, st.URL().Delete(ctx, url))
+	assert.True(t, st.URL().IsDeleted(ctx, url.ID))
+	u, err := st.URL().FindByUUID(ctx, url.URLShort)
+	require.NoError(t, err)
+	assert.True(t, u.IsDeleted)
+	assert.Equal(t, 3, backend.lookups)
+}
+
+func TestStoreNegative(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStore{Store: memstore.New()}
+	st := cachestore.New(backend)
+
+	url := model.TestURLGenerated(t)
+
+	for i := 0; i < 3; i++ {
+		_, err := st.URL().FindByUUID(ctx, url.URLShort)
+		assert.ErrorIs(t, err, store.ErrRecordNotFound)
+	}
+	assert.Equal(t, 1, backend.lookups)
+
+	err := st.WithTx(ctx, func(tx store.Store) error {
+		return tx.URL().Create(ctx, url)
+	})
+	require.NoError(t, err)
+
+	u, err := st.URL().FindByUUID(ctx, url.URLShort)
+	require.NoError(t, err)
+	assert.Equal(t, url.ID, u.ID)
+}
+
+func TestStoreCaseInsensitive(t *testing.T) {
+	ctx := context.Background()
+	st := cachestore.New(
+		memstore.New(memstore.WithOptions(store.Options{Case: store.CaseInsensitive})),
+		cachestore.WithOptions(store.Options{Case: store.CaseInsensitive}),
+	)
+
+	url := model.TestURLGenerated(t)
+	url.URLShort = "alias"
+
+	for _, short := range []string{"ALIAS", "alias"} {
+		_, err := st.URL().FindByUUID(ctx, short)
+		assert.ErrorIs(t, err, store.ErrRecordNotFound)
+	}
+
+	require.NoError(t, st.URL().Create(ctx, url))
+
+	// neither the code nor the one in another case is known as unknown
+	for _, short := range []string{"ALIAS", "alias"} {
+		u, err := st.URL().FindByUUID(ctx, short)
+		require.NoError(t, err, short)
+		assert.Equal(t, url.ID, u.ID)
+	}
+}
+
+func TestStoreEviction(t *testing.T) {
+	ctx := context.Background()
+	backend := &countingStore{Store: memstore.New()}
+	st := cachestore.New(backend, cachestore.WithSize(2), cachestore.WithTTL(20*time.Millisecond))
+
+	urls := make([]*model.URL, 3)
+	for i := range urls {
+		urls[i] = model.TestURLGenerated(t)
+		require.NoError(t, st.URL().Create(ctx, urls[i]))
+		_, err := st.URL().FindByUUID(ctx, urls[i].URLShort)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, backend.lookups)
+
+	// the first one has been evicted
+	_, _ = st.URL().FindByUUID(ctx, urls[2].URLShort)
+	_, _ = st.URL().FindByUUID(ctx, urls[0].URLShort)
+	assert.Equal(t, 4, backend.lookups)
+
+	time.Sleep(30 * time.Millisecond)
+	_, _ = st.URL().FindByUUID(ctx, urls[0].URLShort)
+	assert.Equal(t, 5, backend.lookups)
+}
@@ -0,0 +1,142 @@
+package cachestore
+
+import (
+	"context"
+	"errors"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"time"
+)
+
+type URLRepository struct {
+	store *Store
+	next  store.URLRepository
+}
+
+// IsDeleted answers from the cache for a url which has been found by its
+// short code.
+func (r *URLRepository) IsDeleted(ctx context.Context, id int) bool {
+	if r.store.changed == nil {
+		if url, ok := r.store.cache.getByID(id); ok && url != nil {
+			return url.IsDeleted
+		}
+	}
+
+	return r.next.IsDeleted(ctx, id)
+}
+
+func (r *URLRepository) BatchDelete(ctx context.Context, ids []int) error {
+	err := r.next.BatchDelete(ctx, ids)
+	for _, id := range ids {
+		r.store.forgetID(id)
+	}
+
+	return err
+}
+
+func (r *URLRepository) DeleteExpired(ctx context.Context, now time.Time) ([]int, error) {
+	ids, err := r.next.DeleteExpired(ctx, now)
+	for _, id := range ids {
+		r.store.forgetID(id)
+	}
+
+	return ids, err
+}
+
+func (r *URLRepository) Purge(ctx context.Context, ids []int) error {
+	err := r.next.Purge(ctx, ids)
+	for _, id := range ids {
+		r.store.forgetID(id)
+	}
+
+	return err
+}
+
+func (r *URLRepository) PurgeDeleted(ctx context.Context, before time.Time) ([]int, error) {
+	ids, err := r.next.PurgeDeleted(ctx, before)
+	for _, id := range ids {
+		r.store.forgetID(id)
+	}
+
+	return ids, err
+}
+
+func (r *URLRepository) Delete(ctx context.Context, url *model.URL) error {
+	err := r.next.Delete(ctx, url)
+	r.store.forgetID(url.ID)
+
+	return err
+}
+
+// Create drops the code from the cache, it may be cached as unknown. So
+// does the code the url is given, which the wrapped store may have
+// generated or folded.
+func (r *URLRepository) Create(ctx context.Context, url *model.URL) error {
+	short := url.URLShort
+	err := r.next.Create(ctx, url)
+	r.store.forgetShort(short)
+	r.store.forgetShort(url.URLShort)
+
+	return err
+}
+
+func (r *URLRepository) BatchCreate(ctx context.Context, urls []*model.URL) ([]bool, error) {
+	shorts := make([]string, len(urls))
+	for i, url := range urls {
+		shorts[i] = url.URLShort
+	}
+
+	created, err := r.next.BatchCreate(ctx, urls)
+	for i, short := range shorts {
+		r.store.forgetShort(short)
+		r.store.forgetShort(urls[i].URLShort)
+	}
+
+	return created, err
+}
+
+func (r *URLRepository) FindByID(ctx context.Context, id int) (*model.URL, error) {
+	return r.next.FindByID(ctx, id)
+}
+
+func (r *URLRepository) FindByUUID(ctx context.Context, uuid string) (*model.URL, error) {
+	if r.store.changed != nil {
+		return r.next.FindByUUID(ctx, uuid)
+	}
+
+	if url, ok := r.store.cache.get(uuid); ok {
+		if url == nil {
+			return nil, store.ErrRecordNotFound
+		}
+		return url, nil
+	}
+
+	gen := r.store.cache.generation()
+
+	url, err := r.next.FindByUUID(ctx, uuid)
+	switch {
+	case err == nil:
+		r.store.cache.add(gen, uuid, url)
+	// a code in another case than it is stored in is not cached as
+	// unknown, creating the stored one could not drop it
+	case errors.Is(err, store.ErrRecordNotFound) && uuid == r.store.Case.Fold(uuid):
+		r.store.cache.add(gen, uuid, nil)
+	}
+
+	return url, err
+}
+
+func (r *URLRepository) FindByUserID(ctx context.Context, id int) ([]*model.URL, error) {
+	return r.next.FindByUserID(ctx, id)
+}
+
+func (r *URLRepository) FindByUserIDPage(ctx context.Context, id int, q store.URLQuery) ([]*model.URL, error) {
+	return r.next.FindByUserIDPage(ctx, id, q)
+}
+
+func (r *URLRepository) UpdateUserID(ctx context.Context, url *model.URL, userID int) error {
+	err := r.next.UpdateUserID(ctx, url, userID)
+	r.store.forgetID(url.ID)
+
+	return err
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"errors"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/shortcode"
+	"strings"
+)
+
+// Case is whether the short codes are told apart by the case of their
+// letters.
+type Case int
+
+const (
+	// CaseSensitive keeps the codes as they are and finds them only as they
+	// were stored.
+	CaseSensitive Case = iota
+	// CaseInsensitive stores the codes in lower case and finds them however
+	// they are typed. The codes stored before keep being found as they are.
+	// It fits a lower case alphabet best: the upper case letters of the
+	// others only make more codes collide.
+	CaseInsensitive
+)
+
+func ParseCase(insensitive bool) Case {
+	if insensitive {
+		return CaseInsensitive
+	}
+
+	return CaseSensitive
+}
+
+// Fold is the code as it is stored.
+func (c Case) Fold(short string) string {
+	if c == CaseInsensitive {
+		return strings.ToLower(short)
+	}
+
+	return short
+}
+
+// FoldAll folds the codes the urls come with.
+func (c Case) FoldAll(urls ...*model.URL) {
+	for _, url := range urls {
+		url.URLShort = c.Fold(url.URLShort)
+	}
+}
+
+// Generator makes gen's codes the way they are stored.
+func (c Case) Generator(gen shortcode.Generator) shortcode.Generator {
+	if c == CaseInsensitive {
+		return foldingGenerator{gen}
+	}
+
+	return gen
+}
+
+// Find looks the code up with find as it is given and then, if it is not
+// there, folded.
+func (c Case) Find(short string, find func(short string) (*model.URL, error)) (*model.URL, error) {
+	url, err := find(short)
+	if folded := c.Fold(short); errors.Is(err, ErrRecordNotFound) && folded != short {
+		return find(folded)
+	}
+
+	return url, err
+}
+
+type foldingGenerator struct {
+	gen shortcode.Generator
+}
+
+func (g foldingGenerator) Generate(id, attempt int) string {
+	return strings.ToLower(g.gen.Generate(id, attempt))
+}
@@ -0,0 +1,187 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+)
+
+const copyBatchSize = 500
+
+var ErrNotCopyable = errors.New("store does not support copying")
+
+// Exporter lists every record of a store in ID order. fn must not use the
+// store it is called from.
+type Exporter interface {
+	ExportUsers(ctx context.Context, fn func(user *model.User) error) error
+	ExportURLs(ctx context.Context, fn func(url *model.URL) error) error
+}
+
+// Importer stores records with the IDs they already have. A record whose ID
+// is already there is overwritten, so an import can be repeated; a record
+// whose short code, original URL or uuid belongs to another ID is an error.
+type Importer interface {
+	ImportUsers(ctx context.Context, users []*model.User) error
+	ImportURLs(ctx context.Context, urls []*model.URL) error
+}
+
+// URLSequence is a store which can tell and raise the last url ID it has
+// handed out. Copy carries it over when both stores are one, so that the
+// destination does not hand out the IDs purged at the end of the source.
+type URLSequence interface {
+	LastURLID(ctx context.Context) (int, error)
+	RaiseURLID(ctx context.Context, id int) error
+}
+
+// Progress is told how many records of a kind ("users" or "urls") have been
+// handled so far.
+type Progress func(kind string, n int)
+
+// Copy streams every user and then every url from src to dst, IDs, owners
+// and the deleted state included.
+func Copy(ctx context.Context, dst, src Store, progress Progress) error {
+	from, ok := src.(Exporter)
+	if !ok {
+		return fmt.Errorf("source: %w", ErrNotCopyable)
+	}
+	to, ok := dst.(Importer)
+	if !ok {
+		return fmt.Errorf("destination: %w", ErrNotCopyable)
+	}
+
+	var users []*model.User
+	n := 0
+	flushUsers := func() error {
+		if err := to.ImportUsers(ctx, users); err != nil {
+			return err
+		}
+		n += len(users)
+		users = users[:0]
+		report(progress, "users", n)
+		return nil
+	}
+
+	err := from.ExportUsers(ctx, func(user *model.User) error {
+		users = append(users, user)
+		if len(users) < copyBatchSize {
+			return nil
+		}
+		return flushUsers()
+	})
+	if err == nil && len(users) > 0 {
+		err = flushUsers()
+	}
+	if err != nil {
+		return fmt.Errorf("copy users: %w", err)
+	}
+
+	var urls []*model.URL
+	n = 0
+	flushURLs := func() error {
+		if err := to.ImportURLs(ctx, urls); err != nil {
+			return err
+		}
+		n += len(urls)
+		urls = urls[:0]
+		report(progress, "urls", n)
+		return nil
+	}
+
+	err = from.ExportURLs(ctx, func(url *model.URL) error {
+		urls = append(urls, url)
+		if len(urls) < copyBatchSize {
+			return nil
+		}
+		return flushURLs()
+	})
+	if err == nil && len(urls) > 0 {
+		err = flushURLs()
+	}
+	if err != nil {
+		return fmt.Errorf("copy urls: %w", err)
+	}
+
+	return copySequence(ctx, dst, src)
+}
+
+func copySequence(ctx context.Context, dst, src Store) error {
+	from, ok := src.(URLSequence)
+	if !ok {
+		return nil
+	}
+	to, ok := dst.(URLSequence)
+	if !ok {
+		return nil
+	}
+
+	id, err := from.LastURLID(ctx)
+	if err != nil {
+		return fmt.Errorf("copy url sequence: %w", err)
+	}
+	if err := to.RaiseURLID(ctx, id); err != nil {
+		return fmt.Errorf("copy url sequence: %w", err)
+	}
+
+	return nil
+}
+
+// Verify checks that every record of src is in dst as it is in src and
+// returns the records which are not, up to limit of them.
+func Verify(ctx context.Context, dst, src Store, limit int) ([]string, error) {
+	from, ok := src.(Exporter)
+	if !ok {
+		return nil, fmt.Errorf("source: %w", ErrNotCopyable)
+	}
+
+	var mismatches []string
+	errEnough := errors.New("enough mismatches")
+
+	mismatch := func(format string, args ...interface{}) error {
+		mismatches = append(mismatches, fmt.Sprintf(format, args...))
+		if len(mismatches) >= limit {
+			return errEnough
+		}
+		return nil
+	}
+
+	err := from.ExportUsers(ctx, func(user *model.User) error {
+		v, err := dst.User().FindByID(ctx, user.ID)
+		if errors.Is(err, ErrUserNotFound) {
+			return mismatch("user %d is missing", user.ID)
+		}
+		if err != nil {
+			return err
+		}
+		if *v != *user {
+			return mismatch("user %d differs: %+v, want %+v", user.ID, *v, *user)
+		}
+		return nil
+	})
+	if err == nil {
+		err = from.ExportURLs(ctx, func(url *model.URL) error {
+			v, err := dst.URL().FindByID(ctx, url.ID)
+			if errors.Is(err, ErrRecordNotFound) {
+				return mismatch("url %d is missing", url.ID)
+			}
+			if err != nil {
+				return err
+			}
+			if !v.Equal(url) {
+				return mismatch("url %d differs: %+v, want %+v", url.ID, *v, *url)
+			}
+			return nil
+		})
+	}
+	if err != nil && !errors.Is(err, errEnough) {
+		return nil, err
+	}
+
+	return mismatches, nil
+}
+
+func report(progress Progress, kind string, n int) {
+	if progress != nil {
+		progress(kind, n)
+	}
+}
@@ -0,0 +1,149 @@
+package store_test
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/boltstore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/filestore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/memstore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/sqlitestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+)
+
+// fill creates users owning urls, some of them deleted, leaves a gap in the
+// url IDs and purges the last url.
+func fill(t *testing.T, st store.Store) {
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		user := &model.User{UUID: uuid.New().String()}
+		require.NoError(t, st.User().Create(ctx, user))
+
+		for j := 0; j < 4; j++ {
+			url := model.TestURLGenerated(t)
+			require.NoError(t, st.URL().Create(ctx, url))
+			require.NoError(t, st.URL().UpdateUserID(ctx, url, user.ID))
+			if j%2 == 0 {
+				require.NoError(t, st.URL().Delete(ctx, url))
+			}
+		}
+	}
+
+	_ = st.WithTx(ctx, func(tx store.Store) error {
+		_ = tx.URL().Create(ctx, model.TestURLGenerated(t))
+		return store.ErrRecordNotFound
+	})
+	require.NoError(t, st.URL().Create(ctx, model.TestURLGenerated(t)))
+
+	expiring := model.TestURLGenerated(t)
+	expiresAt := time.Now().Add(time.Hour)
+	expiring.ExpiresAt = &expiresAt
+	require.NoError(t, st.URL().Create(ctx, expiring))
+
+	purged := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(ctx, purged))
+	require.NoError(t, st.URL().Delete(ctx, purged))
+	require.NoError(t, st.URL().Purge(ctx, []int{purged.ID}))
+}
+
+func TestCopy(t *testing.T) {
+	stores := map[string]func(t *testing.T) store.Store{
+		"memstore": func(t *testing.T) store.Store {
+			return memstore.New()
+		},
+		"filestore": func(t *testing.T) store.Store {
+			st, err := filestore.New(t.TempDir() + "/store.txt")
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				st.Close()
+			})
+			return st
+		},
+		"sqlitestore": func(t *testing.T) store.Store {
+			return sqlitestore.TestStore(t)
+		},
+		"boltstore": func(t *testing.T) store.Store {
+			return boltstore.TestStore(t)
+		},
+	}
+
+	for from, newSrc := range stores {
+		for to, newDst := range stores {
+			newSrc, newDst := newSrc, newDst
+			t.Run(from+" to "+to, func(t *testing.T) {
+				ctx := context.Background()
+				src, dst := newSrc(t), newDst(t)
+				fill(t, src)
+
+				var progress []int
+				require.NoError(t, store.Copy(ctx, dst, src, func(kind string, n int) {
+					progress = append(progress, n)
+				}))
+				assert.Equal(t, []int{3, 14}, progress)
+
+				mismatches, err := store.Verify(ctx, dst, src, 10)
+				require.NoError(t, err)
+				assert.Empty(t, mismatches)
+
+				// copying again changes nothing
+				require.NoError(t, store.Copy(ctx, dst, src, nil))
+				mismatches, err = store.Verify(ctx, dst, src, 10)
+				require.NoError(t, err)
+				assert.Empty(t, mismatches)
+
+				// new records come after the copied ones and the purged one
+				last, err := src.(store.URLSequence).LastURLID(ctx)
+				require.NoError(t, err)
+				assert.Greater(t, last, 14)
+				url := model.TestURLGenerated(t)
+				require.NoError(t, dst.URL().Create(ctx, url))
+				assert.Greater(t, url.ID, last)
+			})
+		}
+	}
+}
+
+func TestCopyRepeatFile(t *testing.T) {
+	ctx := context.Background()
+	src := memstore.New()
+	fill(t, src)
+
+	path := t.TempDir() + "/store.txt"
+	dst, err := filestore.New(path)
+	require.NoError(t, err)
+	defer dst.Close()
+
+	require.NoError(t, store.Copy(ctx, dst, src, nil))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	// the deleted and expiring urls are the same when their times are
+	require.NoError(t, store.Copy(ctx, dst, src, nil))
+	again, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), again.Size())
+}
+
+func TestCopyConflict(t *testing.T) {
+	ctx := context.Background()
+	src := memstore.New()
+	dst := sqlitestore.TestStore(t)
+
+	url := model.TestURLGenerated(t)
+	require.NoError(t, src.URL().Create(ctx, url))
+
+	require.NoError(t, dst.URL().Create(ctx, model.TestURLGenerated(t)))
+	require.NoError(t, dst.URL().Create(ctx, &model.URL{URLOrigin: url.URLOrigin, URLShort: "other"}))
+
+	assert.Error(t, store.Copy(ctx, dst, src, nil))
+
+	mismatches, err := store.Verify(ctx, dst, src, 10)
+	require.NoError(t, err)
+	assert.Len(t, mismatches, 1)
+}
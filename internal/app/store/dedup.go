@@ -0,0 +1,51 @@
+package store
+
+import (
+	"fmt"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"strconv"
+)
+
+// Dedup is the scope in which an original URL is shortened only once.
+// Create and BatchCreate return the url which is already there in the
+// scope instead of creating another one.
+type Dedup int
+
+const (
+	// DedupGlobal keeps a single url per original URL.
+	DedupGlobal Dedup = iota
+	// DedupUser keeps a url per original URL and owner, so every user gets
+	// a short code of their own. The urls of nobody share a scope.
+	DedupUser
+)
+
+func ParseDedup(dedup string) (Dedup, error) {
+	switch dedup {
+	case "", "global":
+		return DedupGlobal, nil
+	case "user":
+		return DedupUser, nil
+	default:
+		return DedupGlobal, fmt.Errorf("unknown dedup scope: %s", dedup)
+	}
+}
+
+// Key is what two urls have in common when they are the same in the scope.
+// The stores which keep their own indexes look the original URL up by it.
+func (d Dedup) Key(url *model.URL) string {
+	if d == DedupUser {
+		return strconv.Itoa(url.UserID) + " " + url.URLOrigin
+	}
+
+	return url.URLOrigin
+}
+
+// Owner is the user the scope of the url belongs to, zero for the global
+// scope.
+func (d Dedup) Owner(url *model.URL) int {
+	if d == DedupUser {
+		return url.UserID
+	}
+
+	return 0
+}
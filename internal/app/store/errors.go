@@ -6,4 +6,5 @@ var (
 	ErrUserNotFound   = errors.New("user not found")
 	ErrRecordNotFound = errors.New("record not found")
 	ErrURLExist       = errors.New("url already exists")
+	ErrShortExist     = errors.New("short url already exists")
 )
@@ -0,0 +1,219 @@
+package filestore
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Compact rewrites the file with only the latest version of every record.
+//
+// The snapshot is written to a temporary file without holding the lock, so
+// writers are blocked only while the snapshot is taken and while records
+// appended in the meantime are copied over before the rename.
+func (s *Store) Compact() error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	s.Lock()
+	if s.compacting {
+		s.Unlock()
+		return nil
+	}
+	s.compacting = true
+	s.Unlock()
+
+	return s.compact()
+}
+
+// compact does the actual work of Compact, the caller must have set the
+// compacting flag.
+func (s *Store) compact() error {
+	defer func() {
+		s.Lock()
+		s.compacting = false
+		s.Unlock()
+	}()
+
+	s.Lock()
+	offset := s.size
+	users, urls := s.snapshot()
+	nextURLID := s.nextURLID
+	s.Unlock()
+
+	tmpPath := s.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0777)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	var seq uint64
+
+	for i := range users {
+		seq++
+		if err := encode(w, &users[i], "user", seq); err != nil {
+			return err
+		}
+	}
+	for i := range urls {
+		seq++
+		if err := encode(w, &urls[i], "url", seq); err != nil {
+			return err
+		}
+	}
+
+	// the last urls may have been purged, the counter must not go back
+	if nextURLID > 0 && (len(urls) == 0 || urls[len(urls)-1].ID < nextURLID) {
+		seq++
+		if err := encode(w, []int{nextURLID}, "purge", seq); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	// records appended while the snapshot was written get renumbered so the
+	// sequence keeps growing along the new file
+	tail, err := io.ReadAll(io.NewSectionReader(s.fileDescriptor, offset, s.size-offset))
+	if err != nil {
+		return err
+	}
+	for _, line := range bytes.SplitAfter(tail, []byte{'\n'}) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		f, ok := decode(line)
+		if !ok {
+			return fmt.Errorf("%w written during compaction", ErrCorrupted)
+		}
+
+		seq++
+		f.Seq = seq
+
+		b, err := f.line()
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+
+	size, err := tmp.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_RDWR, 0777)
+	if err != nil {
+		return err
+	}
+
+	if err := syncDir(s.path); err != nil {
+		file.Close()
+		return err
+	}
+
+	s.fileDescriptor.Close()
+	s.fileDescriptor = file
+	s.size = size
+	s.records = int(seq)
+	s.seq = seq
+	s.generation++
+	s.corrupted = 0
+
+	// everything up to seq is in the new file which has just been synced,
+	// the sequence numbers of the old one do not count any more
+	s.syncMu.Lock()
+	s.syncedGeneration = s.generation
+	s.synced = seq
+	s.syncCond.Broadcast()
+	s.syncMu.Unlock()
+
+	return nil
+}
+
+// syncDir flushes the directory entry of path so the rename survives a crash.
+func syncDir(path string) error {
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
+
+// snapshot returns copies of the current records ordered by ID.
+// The caller must hold the lock.
+func (s *Store) snapshot() ([]model.User, []model.URL) {
+	users := make([]model.User, 0, len(s.index.users))
+	for _, v := range s.index.users {
+		users = append(users, v)
+	}
+	sort.Slice(users, func(a, b int) bool {
+		return users[a].ID < users[b].ID
+	})
+
+	urls := make([]model.URL, 0, len(s.index.urls))
+	for _, v := range s.index.urls {
+		urls = append(urls, v)
+	}
+	sort.Slice(urls, func(a, b int) bool {
+		return urls[a].ID < urls[b].ID
+	})
+
+	return users, urls
+}
+
+// needCompaction reports whether the file has grown past the threshold with
+// mostly superseded records. The caller must hold the lock.
+func (s *Store) needCompaction() bool {
+	if s.compactThreshold <= 0 || s.compacting || s.size < s.compactThreshold {
+		return false
+	}
+
+	live := len(s.index.users) + len(s.index.urls)
+
+	return s.records >= 2*live
+}
+
+// compactInBackground starts a compaction that Close waits for.
+// The caller must hold the lock.
+func (s *Store) compactInBackground() {
+	s.compacting = true
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.compact(); err != nil {
+			log.Println("filestore compaction error:", err)
+		}
+	}()
+}
@@ -0,0 +1,144 @@
+package filestore_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/filestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	return bytes.Count(b, []byte{'\n'})
+}
+
+func TestStoreCompact(t *testing.T) {
+	path := t.TempDir() + "/compact.txt"
+
+	st, err := filestore.New(path)
+	require.NoError(t, err)
+
+	user := model.TestUser(t)
+	require.NoError(t, st.User().Create(context.Background(), user))
+
+	var urls []*model.URL
+	for i := 0; i < 5; i++ {
+		url := model.TestURLGenerated(t)
+		require.NoError(t, st.URL().Create(context.Background(), url))
+		require.NoError(t, st.URL().UpdateUserID(context.Background(), url, user.ID))
+		urls = append(urls, url)
+	}
+	require.NoError(t, st.URL().BatchDelete(context.Background(), []int{urls[0].ID, urls[1].ID}))
+
+	assert.Equal(t, 1+5+5+2, countLines(t, path))
+
+	require.NoError(t, st.Compact())
+	assert.Equal(t, 1+5, countLines(t, path))
+
+	// the store keeps working on the new file
+	next := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(context.Background(), next))
+	assert.Equal(t, 1+5+1, countLines(t, path))
+	require.NoError(t, st.Close())
+
+	st, err = filestore.New(path)
+	require.NoError(t, err)
+	defer st.Close()
+
+	for i, v := range urls {
+		u, err := st.URL().FindByID(context.Background(), v.ID)
+		require.NoError(t, err)
+		assert.Equal(t, v.URLShort, u.URLShort)
+		assert.Equal(t, user.ID, u.UserID)
+		assert.Equal(t, i < 2, u.IsDeleted)
+	}
+
+	u, err := st.URL().FindByUUID(context.Background(), next.URLShort)
+	require.NoError(t, err)
+	assert.Equal(t, next.ID, u.ID)
+}
+
+func TestStoreCompactOnStartup(t *testing.T) {
+	path := t.TempDir() + "/compact.txt"
+
+	st, err := filestore.New(path)
+	require.NoError(t, err)
+
+	url := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(context.Background(), url))
+	require.NoError(t, st.URL().Delete(context.Background(), url))
+	require.NoError(t, st.Close())
+	assert.Equal(t, 2, countLines(t, path))
+
+	st, err = filestore.New(path, filestore.WithCompactOnStartup())
+	require.NoError(t, err)
+	defer st.Close()
+	assert.Equal(t, 1, countLines(t, path))
+
+	u, err := st.URL().FindByID(context.Background(), url.ID)
+	require.NoError(t, err)
+	assert.True(t, u.IsDeleted)
+}
+
+func TestStoreCompactThreshold(t *testing.T) {
+	path := t.TempDir() + "/compact.txt"
+
+	st, err := filestore.New(path, filestore.WithCompactThreshold(1))
+	require.NoError(t, err)
+
+	url := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(context.Background(), url))
+	for i := 0; i < 10; i++ {
+		require.NoError(t, st.URL().UpdateUserID(context.Background(), url, i+1))
+	}
+	require.NoError(t, st.Close())
+
+	assert.Less(t, countLines(t, path), 11)
+
+	st, err = filestore.New(path)
+	require.NoError(t, err)
+	defer st.Close()
+
+	u, err := st.URL().FindByID(context.Background(), url.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 10, u.UserID)
+}
+
+func TestStoreCompactPurged(t *testing.T) {
+	path := t.TempDir() + "/compact.txt"
+
+	st, err := filestore.New(path)
+	require.NoError(t, err)
+
+	urls := []*model.URL{model.TestURLGenerated(t), model.TestURLGenerated(t)}
+	_, err = st.URL().BatchCreate(context.Background(), urls)
+	require.NoError(t, err)
+	require.NoError(t, st.URL().Delete(context.Background(), urls[1]))
+	require.NoError(t, st.URL().Purge(context.Background(), []int{urls[1].ID}))
+	assert.Equal(t, 1+1+1, countLines(t, path))
+
+	// the purged ID is the last one, a purge record keeps it from coming back
+	require.NoError(t, st.Compact())
+	assert.Equal(t, 1+1, countLines(t, path))
+	require.NoError(t, st.Close())
+
+	st, err = filestore.New(path)
+	require.NoError(t, err)
+	defer st.Close()
+
+	_, err = st.URL().FindByID(context.Background(), urls[1].ID)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	url := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(context.Background(), url))
+	assert.Greater(t, url.ID, urls[1].ID)
+}
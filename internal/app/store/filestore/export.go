@@ -0,0 +1,124 @@
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"sort"
+)
+
+// ExportUsers calls fn under the read lock, writers wait until the export
+// is done.
+func (s *Store) ExportUsers(ctx context.Context, fn func(user *model.User) error) error {
+	s.RLock()
+	defer s.RUnlock()
+
+	ids := make([]int, 0, len(s.index.users))
+	for id := range s.index.users {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		user := s.index.users[id]
+		if err := fn(&user); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportURLs works like ExportUsers.
+func (s *Store) ExportURLs(ctx context.Context, fn func(url *model.URL) error) error {
+	s.RLock()
+	defer s.RUnlock()
+
+	ids := make([]int, 0, len(s.index.urls))
+	for id := range s.index.urls {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		url := s.index.urls[id]
+		if err := fn(&url); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportUsers appends the users which are new or have changed.
+func (s *Store) ImportUsers(ctx context.Context, users []*model.User) error {
+	return s.update(ctx, false, func() error {
+		for _, user := range users {
+			if id, ok := s.index.usersByUUID[user.UUID]; ok && id != user.ID {
+				return fmt.Errorf("user %d: uuid %s belongs to user %d", user.ID, user.UUID, id)
+			}
+		}
+
+		for _, user := range users {
+			if v, ok := s.index.users[user.ID]; ok && v == *user {
+				continue
+			}
+			if err := s.writeUser(user); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ImportURLs appends the urls which are new or have changed.
+func (s *Store) ImportURLs(ctx context.Context, urls []*model.URL) error {
+	return s.update(ctx, false, func() error {
+		for _, url := range urls {
+			if v, ok := s.index.urlByOrigin(url); ok && v.ID != url.ID {
+				return fmt.Errorf("url %d: %w: %s belongs to url %d", url.ID, store.ErrURLExist, url.URLOrigin, v.ID)
+			}
+			if id, ok := s.index.urlsByShort[url.URLShort]; ok && id != url.ID {
+				return fmt.Errorf("url %d: short code %s belongs to url %d", url.ID, url.URLShort, id)
+			}
+		}
+
+		for _, url := range urls {
+			if v, ok := s.index.urls[url.ID]; ok && v.Equal(url) {
+				continue
+			}
+			if err := s.writeURL(url); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *Store) LastURLID(ctx context.Context) (int, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.nextURLID, ctx.Err()
+}
+
+// RaiseURLID writes a purge record of id, as compaction does, so that the
+// counter is kept when the file is read again.
+func (s *Store) RaiseURLID(ctx context.Context, id int) error {
+	return s.update(ctx, false, func() error {
+		if id <= s.nextURLID {
+			return nil
+		}
+
+		return s.writePurge([]int{id})
+	})
+}
@@ -0,0 +1,62 @@
+package filestore
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// follow picks up records appended by the writing process until the store
+// is closed.
+func (s *Store) follow() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.refresh(); err != nil {
+			log.Println("filestore refresh error:", err)
+		}
+	}
+}
+
+// refresh replays records appended since the last call. When the writer has
+// compacted the file, it is reopened and replayed from the beginning.
+func (s *Store) refresh() error {
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	current, err := s.fileDescriptor.Stat()
+	if err != nil {
+		return err
+	}
+
+	if !os.SameFile(fi, current) || fi.Size() < s.size {
+		file, err := os.Open(s.path)
+		if err != nil {
+			return err
+		}
+
+		s.fileDescriptor.Close()
+		s.fileDescriptor = file
+		s.index = newIndex(s.Dedup)
+		s.nextURLID, s.nextUserID = 0, 0
+		s.size, s.lines, s.records, s.seq = 0, 0, 0, 0
+	} else if fi.Size() == s.size {
+		return nil
+	}
+
+	return s.startup()
+}
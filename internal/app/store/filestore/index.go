@@ -0,0 +1,174 @@
+package filestore
+
+import (
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"sort"
+)
+
+// index keeps the latest version of every record replayed from the log.
+type index struct {
+	urls         map[int]model.URL
+	urlsByShort  map[string]int
+	urlsByOrigin map[string]int
+	urlsByUser   map[int]map[int]struct{}
+
+	users       map[int]model.User
+	usersByUUID map[string]int
+
+	// dedup gives the keys of urlsByOrigin
+	dedup store.Dedup
+
+	// journal collects the undo steps of the running transaction
+	journal []func()
+}
+
+func newIndex(dedup store.Dedup) *index {
+	return &index{
+		dedup:        dedup,
+		urls:         make(map[int]model.URL),
+		urlsByShort:  make(map[string]int),
+		urlsByOrigin: make(map[string]int),
+		urlsByUser:   make(map[int]map[int]struct{}),
+		users:        make(map[int]model.User),
+		usersByUUID:  make(map[string]int),
+	}
+}
+
+func (i *index) putURL(url model.URL) {
+	old, existed := i.urls[url.ID]
+	i.record(func() {
+		if existed {
+			i.putURL(old)
+		} else {
+			i.deleteURL(url.ID)
+		}
+	})
+
+	i.deleteURL(url.ID)
+
+	i.urls[url.ID] = url
+	i.urlsByShort[url.URLShort] = url.ID
+	i.urlsByOrigin[i.dedup.Key(&url)] = url.ID
+
+	ids, ok := i.urlsByUser[url.UserID]
+	if !ok {
+		ids = make(map[int]struct{})
+		i.urlsByUser[url.UserID] = ids
+	}
+	ids[url.ID] = struct{}{}
+}
+
+func (i *index) deleteURL(id int) {
+	old, ok := i.urls[id]
+	if !ok {
+		return
+	}
+
+	delete(i.urls, id)
+	delete(i.urlsByShort, old.URLShort)
+	delete(i.urlsByOrigin, i.dedup.Key(&old))
+	if ids, ok := i.urlsByUser[old.UserID]; ok {
+		delete(ids, old.ID)
+		if len(ids) == 0 {
+			delete(i.urlsByUser, old.UserID)
+		}
+	}
+}
+
+// purgeURL removes a url like deleteURL and can be rolled back.
+func (i *index) purgeURL(id int) {
+	old, ok := i.urls[id]
+	if !ok {
+		return
+	}
+	i.record(func() { i.putURL(old) })
+
+	i.deleteURL(id)
+}
+
+func (i *index) putUser(user model.User) {
+	old, existed := i.users[user.ID]
+	i.record(func() {
+		if existed {
+			i.putUser(old)
+		} else {
+			i.deleteUser(user.ID)
+		}
+	})
+
+	i.deleteUser(user.ID)
+
+	i.users[user.ID] = user
+	i.usersByUUID[user.UUID] = user.ID
+}
+
+func (i *index) deleteUser(id int) {
+	old, ok := i.users[id]
+	if !ok {
+		return
+	}
+
+	delete(i.users, id)
+	delete(i.usersByUUID, old.UUID)
+}
+
+// record remembers how to revert a change while a transaction is running.
+func (i *index) record(undo func()) {
+	if i.journal != nil {
+		i.journal = append(i.journal, undo)
+	}
+}
+
+// rollback reverts every change recorded since the journal was started.
+func (i *index) rollback() {
+	journal := i.journal
+	i.journal = nil
+
+	for k := len(journal) - 1; k >= 0; k-- {
+		journal[k]()
+	}
+}
+
+func (i *index) urlByShort(short string) (model.URL, bool) {
+	id, ok := i.urlsByShort[short]
+	if !ok {
+		return model.URL{}, false
+	}
+
+	return i.urls[id], true
+}
+
+// urlByOrigin finds the url with the original URL of url in its dedup
+// scope.
+func (i *index) urlByOrigin(url *model.URL) (model.URL, bool) {
+	id, ok := i.urlsByOrigin[i.dedup.Key(url)]
+	if !ok {
+		return model.URL{}, false
+	}
+
+	return i.urls[id], true
+}
+
+func (i *index) urlsByUserID(userID int) []model.URL {
+	ids := i.urlsByUser[userID]
+	result := make([]model.URL, 0, len(ids))
+	for id := range ids {
+		result = append(result, i.urls[id])
+	}
+
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].ID < result[b].ID
+	})
+
+	return result
+}
+
+func (i *index) userByUUID(uuid string) (model.User, bool) {
+	id, ok := i.usersByUUID[uuid]
+	if !ok {
+		return model.User{}, false
+	}
+
+	return i.users[id], true
+}
@@ -0,0 +1,15 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package filestore
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// lockFile fails, the file can only be opened read-only on a platform
+// without locks.
+func lockFile(path string) (*os.File, error) {
+	return nil, fmt.Errorf("%w: %s", ErrLockUnsupported, runtime.GOOS)
+}
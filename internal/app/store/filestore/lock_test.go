@@ -0,0 +1,62 @@
+package filestore_test
+
+import (
+	"context"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/filestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestStoreLock(t *testing.T) {
+	path := t.TempDir() + "/lock.txt"
+
+	st, err := filestore.New(path)
+	require.NoError(t, err)
+
+	_, err = filestore.New(path)
+	assert.ErrorIs(t, err, filestore.ErrLocked)
+
+	require.NoError(t, st.Close())
+
+	st, err = filestore.New(path)
+	require.NoError(t, err)
+	require.NoError(t, st.Close())
+}
+
+func TestStoreReadOnly(t *testing.T) {
+	path := t.TempDir() + "/readonly.txt"
+
+	st, err := filestore.New(path)
+	require.NoError(t, err)
+	defer st.Close()
+
+	url := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(context.Background(), url))
+
+	ro, err := filestore.New(path, filestore.WithReadOnly(10*time.Millisecond))
+	require.NoError(t, err)
+	defer ro.Close()
+
+	u, err := ro.URL().FindByUUID(context.Background(), url.URLShort)
+	require.NoError(t, err)
+	assert.Equal(t, url.URLOrigin, u.URLOrigin)
+
+	assert.ErrorIs(t, ro.URL().Create(context.Background(), model.TestURLGenerated(t)), filestore.ErrReadOnly)
+	assert.ErrorIs(t, ro.Compact(), filestore.ErrReadOnly)
+
+	next := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(context.Background(), next))
+	assert.Eventually(t, func() bool {
+		_, err := ro.URL().FindByUUID(context.Background(), next.URLShort)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, st.URL().Delete(context.Background(), url))
+	require.NoError(t, st.Compact())
+	assert.Eventually(t, func() bool {
+		return ro.URL().IsDeleted(context.Background(), url.ID)
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,37 @@
+//go:build windows
+
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/sys/windows"
+	"os"
+)
+
+// lockFile takes an exclusive lock on path, the lock is held until the
+// returned file is closed.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	err = windows.LockFileEx(
+		windows.Handle(f.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0,
+		1,
+		0,
+		new(windows.Overlapped),
+	)
+	if err != nil {
+		f.Close()
+		if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+			return nil, fmt.Errorf("%w: %s", ErrLocked, path)
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
@@ -0,0 +1,57 @@
+package filestore
+
+import (
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"time"
+)
+
+type Option func(*Store)
+
+// WithCompactOnStartup rewrites the file right after it has been replayed.
+func WithCompactOnStartup() Option {
+	return func(s *Store) {
+		s.compactOnStartup = true
+	}
+}
+
+// WithCompactThreshold starts a background compaction once the file is
+// larger than size bytes and at least half of its records are superseded.
+func WithCompactThreshold(size int64) Option {
+	return func(s *Store) {
+		s.compactThreshold = size
+	}
+}
+
+// WithRepair skips corrupted records in the middle of the file instead of
+// failing and rewrites the file without them.
+func WithRepair() Option {
+	return func(s *Store) {
+		s.repair = true
+	}
+}
+
+// WithSync sets the sync mode, interval is used by SyncInterval only.
+func WithSync(mode SyncMode, interval time.Duration) Option {
+	return func(s *Store) {
+		s.syncMode = mode
+		if interval > 0 {
+			s.syncInterval = interval
+		}
+	}
+}
+
+// WithReadOnly opens the file without taking the lock, so it can be served
+// next to the process that writes it. New records are picked up every
+// refresh interval, zero disables following the file.
+func WithReadOnly(refresh time.Duration) Option {
+	return func(s *Store) {
+		s.readOnly = true
+		s.refreshInterval = refresh
+	}
+}
+
+func WithOptions(o store.Options) Option {
+	return func(s *Store) {
+		s.Options = o
+	}
+}
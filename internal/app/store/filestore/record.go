@@ -0,0 +1,91 @@
+package filestore
+
+import (
+	"errors"
+	"github.com/json-iterator/go"
+	"hash/crc32"
+	"io"
+	"strconv"
+)
+
+var (
+	ErrCorrupted       = errors.New("corrupted record")
+	ErrLocked          = errors.New("storage file is used by another process")
+	ErrLockUnsupported = errors.New("storage file can not be locked, open it read-only")
+	ErrReadOnly        = errors.New("storage is read-only")
+)
+
+// File is a single line of the log. Seq grows strictly along the file and
+// Checksum covers Seq, Type and Data. Records written before sequence
+// numbers were introduced have neither and are accepted as is.
+type File struct {
+	Seq      uint64              `json:"seq,omitempty"`
+	Type     string              `json:"type"`
+	Data     jsoniter.RawMessage `json:"data"`
+	Checksum uint32              `json:"checksum,omitempty"`
+}
+
+func (f *File) sum() uint32 {
+	h := crc32.NewIEEE()
+	h.Write([]byte(strconv.FormatUint(f.Seq, 10)))
+	h.Write([]byte{0})
+	h.Write([]byte(f.Type))
+	h.Write([]byte{0})
+	h.Write(f.Data)
+
+	return h.Sum32()
+}
+
+func (f *File) valid() bool {
+	if f.Seq == 0 && f.Checksum == 0 {
+		return true
+	}
+
+	return f.Checksum == f.sum()
+}
+
+// line stamps the checksum and returns the record terminated by a newline.
+func (f *File) line() ([]byte, error) {
+	f.Checksum = f.sum()
+
+	b, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(b, '\n'), nil
+}
+
+// decode parses a line of the log, ok is false for unparsable records and
+// records with a wrong checksum.
+func decode(line []byte) (f *File, ok bool) {
+	f = &File{}
+	if err := json.Unmarshal(line, f); err != nil {
+		return nil, false
+	}
+
+	return f, f.valid()
+}
+
+// encode writes v to w as a single record of the log.
+func encode(w io.Writer, v interface{}, dataType string, seq uint64) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	f := &File{
+		Seq:  seq,
+		Type: dataType,
+		Data: jsoniter.RawMessage(data),
+	}
+
+	b, err := f.line()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+
+	return err
+}
@@ -1,6 +1,10 @@
 package filestore
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
 	"github.com/json-iterator/go"
@@ -8,182 +12,380 @@ import (
 	"log"
 	"os"
 	"sync"
+	"time"
 )
 
 var (
 	json = jsoniter.ConfigCompatibleWithStandardLibrary
 )
 
+// Store keeps every record in memory and uses the file only as an
+// append-only log: it is replayed once on startup and appended on Write.
 type Store struct {
-	sync.Mutex
+	sync.RWMutex
+	wg             sync.WaitGroup
+	path           string
 	fileDescriptor *os.File
 	nextURLID      int
 	nextUserID     int
-	fileData       File
+	index          *index
+
+	// size, lines, records and seq describe the file as it is on disk.
+	size    int64
+	lines   int
+	records int
+	seq     uint64
+	// generation counts the compactions, seq starts over with each
+	generation uint64
+
+	lockFile        *os.File
+	readOnly        bool
+	refreshInterval time.Duration
+
+	repair    bool
+	corrupted int
+
+	store.Options
+
+	compacting       bool
+	compactOnStartup bool
+	compactThreshold int64
+
+	syncMode     SyncMode
+	syncInterval time.Duration
+	syncMu       sync.Mutex
+	syncCond     *sync.Cond
+	syncing      bool
+	synced       uint64
+	// syncedGeneration is the file synced is counted in
+	syncedGeneration uint64
+	// syncs counts the flushes, for the tests
+	syncs   uint64
+	syncErr error
+	done    chan struct{}
+
+	closeOnce sync.Once
+	closeErr  error
+
+	// tx is the running transaction, see WithTx
+	tx *txLog
 }
 
+// Close stops the store and closes the file, only the first call does
+// anything.
 func (s *Store) Close() error {
-	return s.fileDescriptor.Close()
+	s.closeOnce.Do(func() {
+		s.closeErr = s.close()
+	})
+
+	return s.closeErr
 }
 
-func New(filepath string) (*Store, error) {
-	file, err := os.OpenFile(filepath, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0777)
-	if err != nil {
-		return nil, err
+func (s *Store) close() error {
+	close(s.done)
+	s.wg.Wait()
+
+	if s.syncMode != SyncNever {
+		synced, generation, err := s.fsync()
+
+		s.syncMu.Lock()
+		s.syncErr = err
+		s.setSynced(synced, generation)
+		s.syncMu.Unlock()
 	}
 
+	s.Lock()
+	defer s.Unlock()
+
+	err := s.fileDescriptor.Close()
+	if s.lockFile != nil {
+		s.lockFile.Close()
+	}
+
+	return err
+}
+
+// New opens the file storage at filepath. Unless the store is read-only,
+// an exclusive lock is taken on filepath + ".lock" so that a second process
+// fails with ErrLocked instead of handing out the same IDs. Where files can
+// not be locked only the read-only mode is there, New fails with
+// ErrLockUnsupported otherwise.
+func New(filepath string, opts ...Option) (*Store, error) {
 	s := &Store{
-		fileDescriptor: file,
-		nextURLID:      0,
-		nextUserID:     0,
+		path:         filepath,
+		nextURLID:    0,
+		nextUserID:   0,
+		syncInterval: defaultSyncInterval,
+		done:         make(chan struct{}),
+	}
+	s.syncCond = sync.NewCond(&s.syncMu)
+
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Options.Init()
+	s.index = newIndex(s.Dedup)
+
+	if s.readOnly {
+		file, err := os.Open(filepath)
+		if err != nil {
+			return nil, err
+		}
+		s.fileDescriptor = file
+		s.syncMode = SyncNever
+	} else {
+		lock, err := lockFile(filepath + ".lock")
+		if err != nil {
+			return nil, err
+		}
+
+		file, err := os.OpenFile(filepath, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0777)
+		if err != nil {
+			lock.Close()
+			return nil, err
+		}
+		s.lockFile = lock
+		s.fileDescriptor = file
 	}
 
-	s.startup()
+	if err := s.startup(); err != nil {
+		s.fileDescriptor.Close()
+		if s.lockFile != nil {
+			s.lockFile.Close()
+		}
+		return nil, err
+	}
+	s.synced = s.seq
+
+	if s.syncMode == SyncInterval {
+		s.wg.Add(1)
+		go s.syncLoop()
+	}
+
+	if s.readOnly && s.refreshInterval > 0 {
+		s.wg.Add(1)
+		go s.follow()
+	}
+
+	if !s.readOnly && (s.compactOnStartup || s.corrupted > 0) {
+		if err := s.Compact(); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
 
 	return s, nil
 }
 
-func (s *Store) startup() {
-	data, err := s.Read()
-	if err != nil {
-		log.Fatal(err)
+// startup replays the log from the last known offset, later records win.
+//
+// A broken last record is the trace of an interrupted write and is cut off.
+// A broken record in the middle of the file is reported as ErrCorrupted,
+// unless the store is opened in repair mode: then it is skipped and the
+// file is compacted right after startup. A read-only store never touches
+// the file and stops before an unfinished last record.
+func (s *Store) startup() error {
+	if _, err := s.fileDescriptor.Seek(s.size, io.SeekStart); err != nil {
+		return err
 	}
 
-	var user model.User
-	var url model.URL
-	var f File
+	reader := bufio.NewReader(s.fileDescriptor)
 
-	for _, v := range data {
-		if s.nextUserID > 0 && s.nextURLID > 0 {
-			break
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(line) == 0 {
+			return nil
+		}
+
+		complete := line[len(line)-1] == '\n'
+		_, peekErr := reader.Peek(1)
+		last := !complete || peekErr == io.EOF
+
+		if s.readOnly && !complete {
+			return nil
 		}
-		if err := json.Unmarshal([]byte(v), &f); err == nil {
-			if s.nextUserID == 0 {
-				if f.Type == "user" {
-					if err := json.Unmarshal(f.Data, &user); err == nil {
-						s.nextUserID = user.ID
-					}
+		s.lines++
+
+		f, ok := decode(line)
+		if ok && f.Seq != 0 && f.Seq <= s.seq {
+			ok = false
+		}
+
+		switch {
+		case len(bytes.TrimSpace(line)) == 0:
+		case ok:
+			if !complete {
+				if _, err := s.fileDescriptor.Write([]byte{'\n'}); err != nil {
+					return err
 				}
+				line = append(line, '\n')
 			}
-			if s.nextURLID == 0 {
-				if f.Type == "url" || f.Type == "" {
-					if err := json.Unmarshal(f.Data, &url); err == nil {
-						s.nextURLID = url.ID
-					}
-				}
+			if f.Seq != 0 {
+				s.seq = f.Seq
 			}
+			s.records++
+			s.apply(f)
+		case last && s.readOnly:
+			s.lines--
+			return nil
+		case last:
+			log.Printf("filestore: truncating torn record at line %d (offset %d)", s.lines, s.size)
+			return s.fileDescriptor.Truncate(s.size)
+		case s.repair:
+			log.Printf("filestore: skipping corrupted record at line %d (offset %d)", s.lines, s.size)
+			s.corrupted++
+		default:
+			return fmt.Errorf("%w at line %d (offset %d)", ErrCorrupted, s.lines, s.size)
 		}
-	}
-}
 
-type File struct {
-	Type string              `json:"type"`
-	Data jsoniter.RawMessage `json:"data"`
+		s.size += int64(len(line))
+	}
 }
 
 func (s *Store) Write(data []byte, dataType ...string) error {
-	s.Mutex.Lock()
-	defer s.Mutex.Unlock()
 	dt := "url"
 	if len(dataType) > 0 {
 		dt = dataType[0]
 	}
 
+	return s.update(context.Background(), false, func() error {
+		return s.write(data, dt)
+	})
+}
+
+// write appends the record to the file and applies it to the index. Inside
+// a transaction the record is only applied and kept until the commit.
+// The caller must hold the lock.
+func (s *Store) write(data []byte, dataType string) error {
 	f := &File{
+		Type: dataType,
 		Data: jsoniter.RawMessage(data),
-		Type: dt,
 	}
 
-	b, err := json.Marshal(f)
-	if err != nil {
-		return err
+	if s.tx != nil {
+		s.tx.records = append(s.tx.records, f)
+		s.apply(f)
+		return nil
 	}
 
-	b = append(b, '\n')
-
-	_, err = s.fileDescriptor.Write(b)
+	if err := s.append(f); err != nil {
+		return err
+	}
+	s.apply(f)
 
-	return err
+	return nil
 }
 
-func (s *Store) ReadUsers() ([]model.User, error) {
-	f := File{}
-	u := model.User{}
-	var users []model.User
+// append numbers the record and appends it to the file.
+// The caller must hold the lock.
+func (s *Store) append(f *File) error {
+	s.seq++
+	f.Seq = s.seq
 
-	data, err := s.Read()
+	b, err := f.line()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	for _, v := range data {
-		if err := json.Unmarshal([]byte(v), &f); err == nil {
-			if f.Type == "user" {
-				if err := json.Unmarshal(f.Data, &u); err == nil {
-					users = append(users, u)
-				}
-			}
-		}
+	if _, err := s.fileDescriptor.Write(b); err != nil {
+		return err
 	}
 
-	return users, nil
-}
-
-func (s *Store) ReadUrls() ([]model.URL, error) {
-	f := File{}
-	u := model.URL{}
-	var urls []model.URL
+	s.size += int64(len(b))
+	s.records++
 
-	data, err := s.Read()
-	if err != nil {
-		return nil, err
+	if s.needCompaction() {
+		s.compactInBackground()
 	}
 
-	for _, v := range data {
-		if err := json.Unmarshal([]byte(v), &f); err == nil {
-			if f.Type != "user" {
-				if err := json.Unmarshal(f.Data, &u); err == nil {
-					urls = append(urls, u)
-				}
-			}
-		}
+	return nil
+}
+
+func (s *Store) writeURL(url *model.URL) error {
+	b, err := json.Marshal(url)
+	if err != nil {
+		return err
 	}
 
-	return urls, nil
+	return s.write(b, "url")
 }
 
-func (s *Store) Read() ([]string, error) {
-	reader, err := s.Reader()
+func (s *Store) writeUser(user *model.User) error {
+	b, err := json.Marshal(user)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var lines []string
+	return s.write(b, "user")
+}
 
-	for {
-		line, err := reader.LineReversed()
-		if err != nil {
-			if err == io.EOF {
-				return lines, nil
+// apply updates the index with a single record of the log.
+func (s *Store) apply(f *File) {
+	switch f.Type {
+	case "user":
+		var user model.User
+		if err := json.Unmarshal(f.Data, &user); err != nil {
+			return
+		}
+		s.index.putUser(user)
+		if user.ID > s.nextUserID {
+			s.nextUserID = user.ID
+		}
+	case "url", "":
+		var url model.URL
+		if err := json.Unmarshal(f.Data, &url); err != nil {
+			return
+		}
+		s.putURL(url)
+	case "urls":
+		var urls []model.URL
+		if err := json.Unmarshal(f.Data, &urls); err != nil {
+			return
+		}
+		for _, url := range urls {
+			s.putURL(url)
+		}
+	case "purge":
+		// a purged ID is not handed out again, even when compaction has
+		// dropped every record of it
+		var ids []int
+		if err := json.Unmarshal(f.Data, &ids); err != nil {
+			return
+		}
+		for _, id := range ids {
+			s.index.purgeURL(id)
+			if id > s.nextURLID {
+				s.nextURLID = id
 			}
-			return nil, err
 		}
-		if len(line) == 0 {
-			continue
+	case "tx":
+		var records []*File
+		if err := json.Unmarshal(f.Data, &records); err != nil {
+			return
+		}
+		for _, r := range records {
+			s.apply(r)
 		}
-
-		lines = append(lines, line)
 	}
 }
 
-func (s *Store) Reader() (*Reader, error) {
-	file := s.fileDescriptor
-	fi, err := file.Stat()
+func (s *Store) writePurge(ids []int) error {
+	b, err := json.Marshal(ids)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return NewReader(file, int(fi.Size())), nil
+	return s.write(b, "purge")
+}
+
+func (s *Store) putURL(url model.URL) {
+	s.index.putURL(url)
+	if url.ID > s.nextURLID {
+		s.nextURLID = url.ID
+	}
 }
 
 func (s *Store) URL() store.URLRepository {
@@ -194,6 +396,6 @@ func (s *Store) User() store.UserRepository {
 	return &UserRepository{store: s}
 }
 
-func (s *Store) Ping() error {
-	return nil
+func (s *Store) Ping(ctx context.Context) error {
+	return ctx.Err()
 }
@@ -0,0 +1,182 @@
+package filestore_test
+
+import (
+	"context"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/shortcode"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/filestore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, n int) (string, []*model.URL) {
+	t.Helper()
+
+	path := t.TempDir() + "/store.txt"
+
+	st, err := filestore.New(path)
+	require.NoError(t, err)
+	defer st.Close()
+
+	var urls []*model.URL
+	for i := 0; i < n; i++ {
+		url := model.TestURLGenerated(t)
+		require.NoError(t, st.URL().Create(context.Background(), url))
+		urls = append(urls, url)
+	}
+
+	return path, urls
+}
+
+func TestStoreTornTail(t *testing.T) {
+	path, urls := writeTestFile(t, 3)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0777)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"seq":4,"type":"url","data":{"id":4,"url":"http://exa`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	st, err := filestore.New(path)
+	require.NoError(t, err)
+
+	url := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(context.Background(), url))
+	assert.Equal(t, urls[2].ID+1, url.ID)
+	require.NoError(t, st.Close())
+
+	assert.Equal(t, 4, countLines(t, path))
+
+	st, err = filestore.New(path)
+	require.NoError(t, err)
+	defer st.Close()
+
+	u, err := st.URL().FindByUUID(context.Background(), url.URLShort)
+	require.NoError(t, err)
+	assert.Equal(t, url.URLOrigin, u.URLOrigin)
+}
+
+func TestStoreCorrupted(t *testing.T) {
+	path, urls := writeTestFile(t, 3)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(b), "\n")
+	lines[1] = strings.Replace(lines[1], urls[1].URLShort, "corrupt!", 1)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "")), 0777))
+
+	_, err = filestore.New(path)
+	assert.ErrorIs(t, err, filestore.ErrCorrupted)
+
+	st, err := filestore.New(path, filestore.WithRepair())
+	require.NoError(t, err)
+	require.NoError(t, st.Close())
+
+	assert.Equal(t, 2, countLines(t, path))
+
+	st, err = filestore.New(path)
+	require.NoError(t, err)
+	defer st.Close()
+
+	_, err = st.URL().FindByID(context.Background(), urls[1].ID)
+	assert.Error(t, err)
+
+	u, err := st.URL().FindByID(context.Background(), urls[2].ID)
+	require.NoError(t, err)
+	assert.Equal(t, urls[2].URLShort, u.URLShort)
+}
+
+func TestStoreLegacyRecords(t *testing.T) {
+	path := t.TempDir() + "/legacy.txt"
+
+	legacy := `{"type":"user","data":{"id":1,"uuid":"353ba025-7285-4790-bfeb-b70c1ef18323"}}
+{"type":"url","data":{"id":1,"url":"https://yandex.ru/pogoda/saint-petersburg","url_short":"g1gsHibv","is_deleted":false}}
+`
+	require.NoError(t, os.WriteFile(path, []byte(legacy), 0777))
+
+	st, err := filestore.New(path)
+	require.NoError(t, err)
+	defer st.Close()
+
+	u, err := st.URL().FindByUUID(context.Background(), "g1gsHibv")
+	require.NoError(t, err)
+	assert.Equal(t, 1, u.ID)
+
+	url := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(context.Background(), url))
+	assert.Equal(t, 2, url.ID)
+}
+
+func TestStore(t *testing.T) {
+	for name, opts := range map[string][]filestore.Option{
+		"default":     nil,
+		"sync always": {filestore.WithSync(filestore.SyncAlways, 0)},
+	} {
+		opts := opts
+		t.Run(name, func(t *testing.T) {
+			storetest.Run(t, func(t *testing.T) store.Store {
+				st, err := filestore.New(t.TempDir()+"/store.txt", opts...)
+				require.NoError(t, err)
+				t.Cleanup(func() {
+					st.Close()
+				})
+
+				return st
+			})
+		})
+	}
+}
+
+func TestStoreDedupUser(t *testing.T) {
+	storetest.RunDedupUser(t, func(t *testing.T) store.Store {
+		st, err := filestore.New(t.TempDir()+"/store.txt", filestore.WithOptions(store.Options{Dedup: store.DedupUser}))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			st.Close()
+		})
+
+		return st
+	})
+}
+
+func TestStoreGenerator(t *testing.T) {
+	storetest.RunGenerator(t, func(t *testing.T, gen shortcode.Generator) store.Store {
+		st, err := filestore.New(t.TempDir()+"/store.txt", filestore.WithOptions(store.Options{Generator: gen}))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			st.Close()
+		})
+
+		return st
+	})
+}
+
+func TestStoreCaseInsensitive(t *testing.T) {
+	storetest.RunCaseInsensitive(t, func(t *testing.T, gen shortcode.Generator) store.Store {
+		st, err := filestore.New(
+			t.TempDir()+"/store.txt",
+			filestore.WithOptions(store.Options{Generator: gen, Case: store.CaseInsensitive}),
+		)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			st.Close()
+		})
+
+		return st
+	})
+}
+
+func TestStoreCloseTwice(t *testing.T) {
+	st, err := filestore.New(t.TempDir()+"/store.txt", filestore.WithSync(filestore.SyncInterval, 0))
+	require.NoError(t, err)
+
+	require.NoError(t, st.Close())
+	assert.NotPanics(t, func() {
+		assert.NoError(t, st.Close())
+	})
+}
@@ -0,0 +1,156 @@
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const defaultSyncInterval = 10 * time.Millisecond
+
+// SyncMode tells when the file is flushed to stable storage.
+type SyncMode int
+
+const (
+	// SyncNever leaves flushing to the operating system.
+	SyncNever SyncMode = iota
+	// SyncAlways flushes before a write returns. Writers waiting at the same
+	// time share a single fsync.
+	SyncAlways
+	// SyncInterval flushes periodically in the background, a write returns
+	// once the next flush has covered it.
+	SyncInterval
+)
+
+func ParseSyncMode(mode string) (SyncMode, error) {
+	switch mode {
+	case "", "never":
+		return SyncNever, nil
+	case "always":
+		return SyncAlways, nil
+	case "interval":
+		return SyncInterval, nil
+	default:
+		return SyncNever, fmt.Errorf("unknown sync mode: %s", mode)
+	}
+}
+
+// update runs fn under the lock and then waits until everything fn has
+// written is durable according to the sync mode. Inside a transaction the
+// lock is already held, fn runs directly and the sync is left to the commit.
+func (s *Store) update(ctx context.Context, tx bool, fn func() error) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if tx {
+		return fn()
+	}
+
+	s.Lock()
+	err := fn()
+	seq, generation := s.seq, s.generation
+	s.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return s.waitSync(seq, generation)
+}
+
+// waitSync blocks until the record with the given sequence number is flushed.
+// A compaction since it was written has flushed it along with the new file.
+func (s *Store) waitSync(seq, generation uint64) error {
+	if s.syncMode == SyncNever {
+		return nil
+	}
+
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	for s.syncedGeneration == generation && s.synced < seq {
+		if s.syncErr != nil {
+			return s.syncErr
+		}
+
+		if s.syncMode == SyncAlways && !s.syncing {
+			s.syncing = true
+			s.syncMu.Unlock()
+			synced, syncedGen, err := s.fsync()
+			s.syncMu.Lock()
+			s.syncing = false
+			s.setSynced(synced, syncedGen)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		s.syncCond.Wait()
+	}
+
+	return nil
+}
+
+// fsync flushes the file and returns the last sequence number it covers
+// and the generation of the file. The read lock keeps compaction from
+// swapping the file in the meantime.
+func (s *Store) fsync() (uint64, uint64, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if err := s.fileDescriptor.Sync(); err != nil {
+		return 0, s.generation, err
+	}
+
+	return s.seq, s.generation, nil
+}
+
+// setSynced records a finished flush and wakes up the waiting writers. A
+// flush of a file which has been compacted since counts for nothing.
+// The caller must hold syncMu.
+func (s *Store) setSynced(seq, generation uint64) {
+	s.syncs++
+	if generation == s.syncedGeneration && seq > s.synced {
+		s.synced = seq
+	}
+	s.syncCond.Broadcast()
+}
+
+// syncLoop flushes the file every syncInterval until the store is closed.
+func (s *Store) syncLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		s.RLock()
+		seq, generation := s.seq, s.generation
+		s.RUnlock()
+
+		s.syncMu.Lock()
+		dirty := generation == s.syncedGeneration && seq > s.synced
+		s.syncMu.Unlock()
+
+		if !dirty {
+			continue
+		}
+
+		synced, generation, err := s.fsync()
+
+		s.syncMu.Lock()
+		s.syncErr = err
+		s.setSynced(synced, generation)
+		s.syncMu.Unlock()
+	}
+}
@@ -0,0 +1,41 @@
+package filestore
+
+import (
+	"context"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestStoreSyncAfterCompact(t *testing.T) {
+	ctx := context.Background()
+	st, err := New(t.TempDir()+"/store.txt", WithSync(SyncAlways, 0))
+	require.NoError(t, err)
+	defer st.Close()
+
+	// the purged urls are dropped, the log gets shorter
+	var ids []int
+	for i := 0; i < 3; i++ {
+		url := model.TestURLGenerated(t)
+		require.NoError(t, st.URL().Create(ctx, url))
+		ids = append(ids, url.ID)
+	}
+	require.NoError(t, st.URL().BatchDelete(ctx, ids))
+	require.NoError(t, st.URL().Purge(ctx, ids))
+
+	before := st.seq
+	require.NoError(t, st.Compact())
+	require.Less(t, st.seq, before)
+
+	st.syncMu.Lock()
+	syncs := st.syncs
+	st.syncMu.Unlock()
+
+	require.NoError(t, st.URL().Create(ctx, model.TestURLGenerated(t)))
+
+	st.syncMu.Lock()
+	defer st.syncMu.Unlock()
+	assert.Equal(t, syncs+1, st.syncs, "the create after compaction is flushed")
+	assert.Equal(t, st.seq, st.synced)
+}
@@ -0,0 +1,86 @@
+package filestore_test
+
+import (
+	"context"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/filestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseSyncMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    filestore.SyncMode
+		wantErr bool
+	}{
+		{mode: "", want: filestore.SyncNever},
+		{mode: "never", want: filestore.SyncNever},
+		{mode: "always", want: filestore.SyncAlways},
+		{mode: "interval", want: filestore.SyncInterval},
+		{mode: "sometimes", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got, err := filestore.ParseSyncMode(tt.mode)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStoreSync(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     filestore.SyncMode
+		interval time.Duration
+	}{
+		{name: "never", mode: filestore.SyncNever},
+		{name: "always", mode: filestore.SyncAlways},
+		{name: "interval", mode: filestore.SyncInterval, interval: 5 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := t.TempDir() + "/sync.txt"
+
+			st, err := filestore.New(path, filestore.WithSync(tt.mode, tt.interval))
+			require.NoError(t, err)
+
+			count := 20
+			urls := make([]*model.URL, count)
+
+			var wg sync.WaitGroup
+			for i := 0; i < count; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					urls[i] = model.TestURLGenerated(t)
+					assert.NoError(t, st.URL().Create(context.Background(), urls[i]))
+				}(i)
+			}
+			wg.Wait()
+			require.NoError(t, st.Close())
+
+			assert.Equal(t, count, countLines(t, path))
+
+			st, err = filestore.New(path)
+			require.NoError(t, err)
+			defer st.Close()
+
+			for _, v := range urls {
+				u, err := st.URL().FindByUUID(context.Background(), v.URLShort)
+				require.NoError(t, err)
+				assert.Equal(t, v.ID, u.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package filestore
+
+import (
+	"context"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+)
+
+// txLog is the state of a running transaction.
+type txLog struct {
+	records    []*File
+	nextURLID  int
+	nextUserID int
+}
+
+// WithTx holds the write lock while fn runs. The records written by fn are
+// applied to the index right away, so fn sees its own changes, and are
+// appended to the file as a single record when fn succeeds: a torn write
+// loses the whole transaction, never a part of it. If fn fails the index
+// is reverted.
+func (s *Store) WithTx(ctx context.Context, fn func(tx store.Store) error) error {
+	return s.update(ctx, false, func() error {
+		t := &txLog{
+			nextURLID:  s.nextURLID,
+			nextUserID: s.nextUserID,
+		}
+		s.tx = t
+		s.index.journal = []func(){}
+
+		committed := false
+		defer func() {
+			s.tx = nil
+			if !committed {
+				s.index.rollback()
+				s.nextURLID = t.nextURLID
+				s.nextUserID = t.nextUserID
+			}
+			s.index.journal = nil
+		}()
+
+		if err := fn(&txStore{store: s}); err != nil {
+			return err
+		}
+		s.tx = nil
+
+		if len(t.records) > 0 {
+			f := t.records[0]
+			if len(t.records) > 1 {
+				b, err := json.Marshal(t.records)
+				if err != nil {
+					return err
+				}
+				f = &File{Type: "tx", Data: b}
+			}
+
+			if err := s.append(f); err != nil {
+				return err
+			}
+		}
+		committed = true
+
+		return nil
+	})
+}
+
+// rlock takes the read lock unless the repository belongs to a transaction
+// which already holds the write lock, and returns the matching unlock.
+func (s *Store) rlock(tx bool) func() {
+	if tx {
+		return func() {}
+	}
+	s.RLock()
+
+	return s.RUnlock
+}
+
+// txStore is the view of the store handed to a WithTx callback.
+type txStore struct {
+	store *Store
+}
+
+func (t *txStore) URL() store.URLRepository {
+	return &URLRepository{store: t.store, tx: true}
+}
+
+func (t *txStore) User() store.UserRepository {
+	return &UserRepository{store: t.store, tx: true}
+}
+
+// WithTx joins the running transaction.
+func (t *txStore) WithTx(ctx context.Context, fn func(tx store.Store) error) error {
+	return fn(t)
+}
+
+func (t *txStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Close does nothing, the store is closed by its owner.
+func (t *txStore) Close() error {
+	return nil
+}
@@ -0,0 +1,72 @@
+package filestore_test
+
+import (
+	"context"
+	"errors"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/filestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestStoreWithTx(t *testing.T) {
+	path := t.TempDir() + "/tx.txt"
+	st, err := filestore.New(path)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	user := model.TestUser(t)
+	url := model.TestURLGenerated(t)
+
+	err = st.WithTx(ctx, func(tx store.Store) error {
+		if err := tx.User().Create(ctx, user); err != nil {
+			return err
+		}
+		if err := tx.URL().Create(ctx, url); err != nil {
+			return err
+		}
+
+		return tx.URL().UpdateUserID(ctx, url, user.ID)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, countLines(t, path))
+
+	errFailed := errors.New("failed")
+	other := model.TestURLGenerated(t)
+
+	err = st.WithTx(ctx, func(tx store.Store) error {
+		if err := tx.URL().Create(ctx, other); err != nil {
+			return err
+		}
+		if err := tx.URL().BatchDelete(ctx, []int{url.ID}); err != nil {
+			return err
+		}
+
+		if _, err := tx.URL().FindByUUID(ctx, other.URLShort); err != nil {
+			return err
+		}
+
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+	assert.Equal(t, 1, countLines(t, path))
+
+	_, err = st.URL().FindByUUID(ctx, other.URLShort)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+	assert.False(t, st.URL().IsDeleted(ctx, url.ID))
+	require.NoError(t, st.Close())
+
+	st, err = filestore.New(path)
+	require.NoError(t, err)
+	defer st.Close()
+
+	u, err := st.URL().FindByUUID(ctx, url.URLShort)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, u.UserID)
+
+	next := model.TestURLGenerated(t)
+	assert.NoError(t, st.URL().Create(ctx, next))
+	assert.Equal(t, url.ID+1, next.ID)
+}
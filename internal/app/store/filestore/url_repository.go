@@ -1,176 +1,294 @@
 package filestore
 
 import (
+	"context"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"sort"
+	"time"
 )
 
 type URLRepository struct {
 	store *Store
+	tx    bool
 }
 
-func (r *URLRepository) IsDeleted(id int) bool {
-	urls, err := r.store.ReadUrls()
-	if err != nil {
-		return false
-	}
+func (r *URLRepository) IsDeleted(ctx context.Context, id int) bool {
+	defer r.store.rlock(r.tx)()
 
-	for _, v := range urls {
-		if id == v.ID {
-			return v.IsDeleted
-		}
-	}
-
-	return false
+	return r.store.index.urls[id].IsDeleted
 }
 
-func (r *URLRepository) BatchDelete(ids []int) error {
-	urls, err := r.store.ReadUrls()
-	if err != nil {
-		return err
-	}
-
-	for _, v := range urls {
-		for _, k := range ids {
-			if k == v.ID {
-				v.IsDeleted = true
+func (r *URLRepository) BatchDelete(ctx context.Context, ids []int) error {
+	return r.store.update(ctx, r.tx, func() error {
+		now := model.Now()
+		for _, id := range ids {
+			v, ok := r.store.index.urls[id]
+			if !ok || v.IsDeleted {
+				continue
+			}
 
-				b, err := json.Marshal(v)
-				if err != nil {
-					return err
-				}
+			v.IsDeleted = true
+			v.DeletedAt = now
 
-				if err := r.store.Write(b, "url"); err != nil {
-					return err
-				}
+			if err := r.store.writeURL(&v); err != nil {
+				return err
 			}
 		}
-	}
 
-	return nil
+		return nil
+	})
 }
 
-func (r *URLRepository) Delete(url *model.URL) error {
-	urls, err := r.store.ReadUrls()
-	if err != nil {
-		return err
-	}
+func (r *URLRepository) DeleteExpired(ctx context.Context, now time.Time) ([]int, error) {
+	var ids []int
 
-	for _, v := range urls {
-		if url.URLOrigin == v.URLOrigin {
-			if v.IsDeleted {
-				return nil
+	err := r.store.update(ctx, r.tx, func() error {
+		for id, v := range r.store.index.urls {
+			if !v.IsDeleted && v.Expired(now) {
+				ids = append(ids, id)
 			}
+		}
+		sort.Ints(ids)
 
+		at := model.Timestamp(&now)
+		for _, id := range ids {
+			v := r.store.index.urls[id]
 			v.IsDeleted = true
+			v.DeletedAt = at
 
-			b, err := json.Marshal(v)
-			if err != nil {
+			if err := r.store.writeURL(&v); err != nil {
 				return err
 			}
-
-			return r.store.Write(b, "url")
 		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return store.ErrRecordNotFound
+	return ids, nil
 }
 
-func (r *URLRepository) Create(url *model.URL) error {
-	if err := url.Validate(); err != nil {
-		return err
-	}
+// Purge writes the IDs which are there and deleted as a single record.
+func (r *URLRepository) Purge(ctx context.Context, ids []int) error {
+	return r.store.update(ctx, r.tx, func() error {
+		var purged []int
+		for _, id := range ids {
+			if v, ok := r.store.index.urls[id]; ok && v.IsDeleted {
+				purged = append(purged, id)
+			}
+		}
+		if len(purged) == 0 {
+			return nil
+		}
+
+		return r.store.writePurge(purged)
+	})
+}
+
+func (r *URLRepository) PurgeDeleted(ctx context.Context, before time.Time) ([]int, error) {
+	var ids []int
 
-	urls, err := r.store.ReadUrls()
+	err := r.store.update(ctx, r.tx, func() error {
+		for id, v := range r.store.index.urls {
+			if v.DeletedBy(before) {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		sort.Ints(ids)
+
+		return r.store.writePurge(ids)
+	})
 	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (r *URLRepository) Delete(ctx context.Context, url *model.URL) error {
+	return r.store.update(ctx, r.tx, func() error {
+		v, ok := r.store.index.urls[url.ID]
+		if !ok {
+			return store.ErrRecordNotFound
+		}
+
+		if v.IsDeleted {
+			return nil
+		}
+
+		v.IsDeleted = true
+		v.DeletedAt = model.Now()
+
+		return r.store.writeURL(&v)
+	})
+}
+
+func (r *URLRepository) Create(ctx context.Context, url *model.URL) error {
+	if err := url.Validate(r.store.MaxURLLength); err != nil {
 		return err
 	}
+	r.store.Case.FoldAll(url)
 
-	for _, v := range urls {
-		if url.URLOrigin == v.URLOrigin {
+	return r.store.update(ctx, r.tx, func() error {
+		if v, ok := r.store.index.urlByOrigin(url); ok {
 			*url = v
 			return store.ErrURLExist
 		}
-	}
 
-	r.store.Lock()
-	url.ID = r.store.nextURLID + 1
-	r.store.nextURLID++
-	r.store.Unlock()
+		v := *url
+		v.ID = r.store.nextURLID + 1
 
-	data, err := json.Marshal(&url)
-	if err != nil {
-		return err
-	}
+		err := store.Generate(r.store.Generator, &v, func() error {
+			if _, ok := r.store.index.urlByShort(v.URLShort); ok {
+				return store.ErrShortExist
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		*url = v
 
-	return r.store.Write(data)
+		return r.store.writeURL(url)
+	})
 }
 
-func (r *URLRepository) FindByID(id int) (*model.URL, error) {
-	urls, err := r.store.ReadUrls()
-	if err != nil {
-		return nil, err
+// BatchCreate writes all new urls as a single record, so a torn write can not
+// leave a part of the batch behind.
+func (r *URLRepository) BatchCreate(ctx context.Context, urls []*model.URL) ([]bool, error) {
+	for _, url := range urls {
+		if err := url.Validate(r.store.MaxURLLength); err != nil {
+			return nil, err
+		}
 	}
+	r.store.Case.FoldAll(urls...)
+
+	created := make([]bool, len(urls))
 
-	for _, v := range urls {
-		if v.ID == id {
-			return &v, nil
+	err := r.store.update(ctx, r.tx, func() error {
+		var batch []*model.URL
+		added := make(map[string]*model.URL)
+		shorts := make(map[string]bool)
+		nextID := r.store.nextURLID
+
+		for i, url := range urls {
+			if v, ok := r.store.index.urlByOrigin(url); ok {
+				*url = v
+				continue
+			}
+			key := r.store.index.dedup.Key(url)
+			if v, ok := added[key]; ok {
+				*url = *v
+				continue
+			}
+
+			url.ID = nextID + 1
+			err := store.Generate(r.store.Generator, url, func() error {
+				if _, ok := r.store.index.urlByShort(url.URLShort); ok || shorts[url.URLShort] {
+					return store.ErrShortExist
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			nextID++
+			added[key] = url
+			shorts[url.URLShort] = true
+			batch = append(batch, url)
+			created[i] = true
 		}
-	}
 
-	return nil, store.ErrRecordNotFound
-}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		b, err := json.Marshal(batch)
+		if err != nil {
+			return err
+		}
 
-func (r *URLRepository) FindByUUID(uuid string) (*model.URL, error) {
-	urls, err := r.store.ReadUrls()
+		return r.store.write(b, "urls")
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	for _, v := range urls {
-		if v.URLShort == uuid {
-			return &v, nil
-		}
+	return created, nil
+}
+
+func (r *URLRepository) FindByID(ctx context.Context, id int) (*model.URL, error) {
+	defer r.store.rlock(r.tx)()
+
+	v, ok := r.store.index.urls[id]
+	if !ok {
+		return nil, store.ErrRecordNotFound
 	}
 
-	return nil, store.ErrRecordNotFound
+	return &v, nil
 }
 
-func (r *URLRepository) FindByUserID(id int) ([]*model.URL, error) {
-	var result []*model.URL
+func (r *URLRepository) FindByUUID(ctx context.Context, uuid string) (*model.URL, error) {
+	return r.store.Case.Find(uuid, func(short string) (*model.URL, error) {
+		return r.findByUUID(ctx, short)
+	})
+}
 
-	urls, err := r.store.ReadUrls()
-	if err != nil {
-		return nil, err
+func (r *URLRepository) findByUUID(ctx context.Context, uuid string) (*model.URL, error) {
+	defer r.store.rlock(r.tx)()
+
+	v, ok := r.store.index.urlByShort(uuid)
+	if !ok {
+		return nil, store.ErrRecordNotFound
 	}
 
-	for _, v := range urls {
-		if v.UserID == id {
-			result = append(result, &v)
-		}
+	return &v, nil
+}
+
+func (r *URLRepository) FindByUserID(ctx context.Context, id int) ([]*model.URL, error) {
+	defer r.store.rlock(r.tx)()
+
+	var result []*model.URL
+
+	for _, v := range r.store.index.urlsByUserID(id) {
+		v := v
+		result = append(result, &v)
 	}
 
 	return result, nil
 }
 
-func (r *URLRepository) UpdateUserID(url *model.URL, userID int) error {
-	url.UserID = userID
+func (r *URLRepository) FindByUserIDPage(ctx context.Context, id int, q store.URLQuery) ([]*model.URL, error) {
+	urls, _ := r.FindByUserID(ctx, id)
 
-	u, err := r.store.URL().FindByUserID(userID)
-	if err != nil {
-		return err
-	}
+	return q.Page(urls), nil
+}
+
+func (r *URLRepository) UpdateUserID(ctx context.Context, url *model.URL, userID int) error {
+	return r.store.update(ctx, r.tx, func() error {
+		v, ok := r.store.index.urls[url.ID]
+		if !ok {
+			return store.ErrRecordNotFound
+		}
+
+		url.UserID = userID
 
-	for _, v := range u {
-		if v.URLShort == url.URLShort && v.UserID == url.UserID {
+		if v.UserID == userID {
 			return nil
 		}
-	}
 
-	b, err := json.Marshal(url)
-	if err != nil {
-		return err
-	}
+		v.UserID = userID
+		if other, ok := r.store.index.urlByOrigin(&v); ok && other.ID != v.ID {
+			return store.ErrURLExist
+		}
 
-	return r.store.Write(b, "url")
+		return r.store.writeURL(&v)
+	})
 }
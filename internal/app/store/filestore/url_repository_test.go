@@ -1,20 +1,18 @@
 package filestore_test
 
 import (
+	"context"
 	"errors"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/store/filestore"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
 )
 
-var (
-	filepath = "testfile.txt"
-)
-
 func TestURLRepository(t *testing.T) {
-	st, err := filestore.New(filepath)
+	st, err := filestore.New(t.TempDir() + "/testfile.txt")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -24,7 +22,7 @@ func TestURLRepository(t *testing.T) {
 	user := model.TestUser(t)
 
 	assert.Condition(t, func() bool {
-		err := st.URL().Create(url)
+		err := st.URL().Create(context.Background(), url)
 		if errors.Is(err, store.ErrURLExist) {
 			return true
 		}
@@ -37,27 +35,27 @@ func TestURLRepository(t *testing.T) {
 
 	assert.NotNil(t, url.ID)
 
-	assert.NoError(t, st.User().Create(user))
+	assert.NoError(t, st.User().Create(context.Background(), user))
 	assert.NotNil(t, user.ID)
 
-	u, err := st.URL().FindByUUID(url.URLShort)
+	u, err := st.URL().FindByUUID(context.Background(), url.URLShort)
 	assert.NoError(t, err)
 	assert.Equal(t, url.URLOrigin, u.URLOrigin)
 
-	u2, err := st.URL().FindByID(url.ID)
+	u2, err := st.URL().FindByID(context.Background(), url.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, u, u2)
 
-	err = st.URL().UpdateUserID(url, user.ID)
+	err = st.URL().UpdateUserID(context.Background(), url, user.ID)
 	assert.NoError(t, err)
 
-	urls, err := st.URL().FindByUserID(user.ID)
+	urls, err := st.URL().FindByUserID(context.Background(), user.ID)
 	assert.NoError(t, err)
 	assert.NotNil(t, urls)
 }
 
 func TestURLRepositoryDelete(t *testing.T) {
-	st, err := filestore.New(filepath)
+	st, err := filestore.New(t.TempDir() + "/testfile.txt")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -65,10 +63,157 @@ func TestURLRepositoryDelete(t *testing.T) {
 
 	url := model.TestURLGenerated(t)
 
-	assert.NoError(t, st.URL().Create(url))
-	assert.NoError(t, st.URL().Delete(url))
+	assert.NoError(t, st.URL().Create(context.Background(), url))
+	assert.NoError(t, st.URL().Delete(context.Background(), url))
 
-	u, err := st.URL().FindByUUID(url.URLShort)
+	u, err := st.URL().FindByUUID(context.Background(), url.URLShort)
 	assert.NoError(t, err)
 	assert.Equal(t, true, u.IsDeleted)
 }
+
+func TestURLRepositoryReplay(t *testing.T) {
+	path := t.TempDir() + "/replay.txt"
+
+	st, err := filestore.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := model.TestURLGenerated(t)
+	user := model.TestUser(t)
+
+	assert.NoError(t, st.URL().Create(context.Background(), url))
+	assert.NoError(t, st.User().Create(context.Background(), user))
+	assert.NoError(t, st.URL().UpdateUserID(context.Background(), url, user.ID))
+	assert.NoError(t, st.URL().BatchDelete(context.Background(), []int{url.ID}))
+	assert.NoError(t, st.Close())
+
+	st, err = filestore.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	u, err := st.URL().FindByUUID(context.Background(), url.URLShort)
+	assert.NoError(t, err)
+	assert.Equal(t, url.URLOrigin, u.URLOrigin)
+	assert.Equal(t, user.ID, u.UserID)
+	assert.True(t, u.IsDeleted)
+
+	urls, err := st.URL().FindByUserID(context.Background(), user.ID)
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1)
+
+	next := model.TestURLGenerated(t)
+	assert.NoError(t, st.URL().Create(context.Background(), next))
+	assert.Equal(t, url.ID+1, next.ID)
+}
+
+func TestURLRepositoryBatchCreate(t *testing.T) {
+	path := t.TempDir() + "/batch.txt"
+	st, err := filestore.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	existing := model.TestURLGenerated(t)
+	assert.NoError(t, st.URL().Create(ctx, existing))
+
+	fresh := model.TestURLGenerated(t)
+	urls := []*model.URL{
+		fresh,
+		{URLOrigin: existing.URLOrigin, URLShort: "existing"},
+		{URLOrigin: fresh.URLOrigin, URLShort: "dup"},
+	}
+
+	created, err := st.URL().BatchCreate(ctx, urls)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false, false}, created)
+	assert.Equal(t, existing.URLShort, urls[1].URLShort)
+	assert.Equal(t, fresh.URLShort, urls[2].URLShort)
+	assert.Equal(t, fresh.ID, urls[2].ID)
+
+	u, err := st.URL().FindByUUID(ctx, fresh.URLShort)
+	assert.NoError(t, err)
+	assert.Equal(t, fresh.ID, u.ID)
+
+	invalid := model.TestURLGenerated(t)
+	_, err = st.URL().BatchCreate(ctx, []*model.URL{invalid, {URLOrigin: "http://wrong", URLShort: "wrong"}})
+	assert.Error(t, err)
+
+	_, err = st.URL().FindByUUID(ctx, invalid.URLShort)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	assert.NoError(t, st.Close())
+
+	st, err = filestore.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	u, err = st.URL().FindByUUID(ctx, fresh.URLShort)
+	assert.NoError(t, err)
+	assert.Equal(t, fresh.ID, u.ID)
+
+	next := model.TestURLGenerated(t)
+	assert.NoError(t, st.URL().Create(ctx, next))
+	assert.Equal(t, fresh.ID+1, next.ID)
+}
+
+func TestURLRepositoryFindByUserIDPage(t *testing.T) {
+	st, err := filestore.New(t.TempDir() + "/page.txt")
+	require.NoError(t, err)
+	defer st.Close()
+	ctx := context.Background()
+
+	var urls []*model.URL
+	for i := 0; i < 5; i++ {
+		url := model.TestURLGenerated(t)
+		require.NoError(t, st.URL().Create(ctx, url))
+		require.NoError(t, st.URL().UpdateUserID(ctx, url, 1))
+		urls = append(urls, url)
+	}
+	require.NoError(t, st.URL().Create(ctx, model.TestURLGenerated(t)))
+	require.NoError(t, st.URL().BatchDelete(ctx, []int{urls[1].ID}))
+
+	ids := func(urls []*model.URL) []int {
+		var result []int
+		for _, url := range urls {
+			result = append(result, url.ID)
+		}
+		return result
+	}
+
+	page, err := st.URL().FindByUserIDPage(ctx, 1, store.URLQuery{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, ids(urls[:2]), ids(page))
+
+	page, err = st.URL().FindByUserIDPage(ctx, 1, store.URLQuery{Limit: 2, After: page[1]})
+	require.NoError(t, err)
+	assert.Equal(t, ids(urls[2:4]), ids(page))
+
+	page, err = st.URL().FindByUserIDPage(ctx, 1, store.URLQuery{Desc: true, After: urls[2]})
+	require.NoError(t, err)
+	assert.Equal(t, []int{urls[1].ID, urls[0].ID}, ids(page))
+
+	page, err = st.URL().FindByUserIDPage(ctx, 1, store.URLQuery{ExcludeDeleted: true})
+	require.NoError(t, err)
+	assert.Equal(t, []int{urls[0].ID, urls[2].ID, urls[3].ID, urls[4].ID}, ids(page))
+
+	page, err = st.URL().FindByUserIDPage(ctx, 1, store.URLQuery{OriginContains: urls[3].URLOrigin})
+	require.NoError(t, err)
+	assert.Equal(t, []int{urls[3].ID}, ids(page))
+
+	page, err = st.URL().FindByUserIDPage(ctx, 1, store.URLQuery{Sort: store.SortByShort})
+	require.NoError(t, err)
+	require.Len(t, page, len(urls))
+	for i := 1; i < len(page); i++ {
+		assert.Less(t, page[i-1].URLShort, page[i].URLShort)
+	}
+
+	page, err = st.URL().FindByUserIDPage(ctx, 1, store.URLQuery{Sort: store.SortByShort, After: page[2]})
+	require.NoError(t, err)
+	assert.Len(t, page, 2)
+}
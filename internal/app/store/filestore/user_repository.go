@@ -1,59 +1,47 @@
 package filestore
 
 import (
+	"context"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
 )
 
 type UserRepository struct {
 	store *Store
+	tx    bool
 }
 
-func (r *UserRepository) Create(user *model.User) error {
-	if u, _ := r.FindByUUID(user.UUID); u != nil {
-		user.ID = u.ID
-		return nil
-	}
-
-	r.store.Lock()
-	user.ID = r.store.nextUserID + 1
-	r.store.nextUserID++
-	r.store.Unlock()
+func (r *UserRepository) Create(ctx context.Context, user *model.User) error {
+	return r.store.update(ctx, r.tx, func() error {
+		if u, ok := r.store.index.userByUUID(user.UUID); ok {
+			user.ID = u.ID
+			return nil
+		}
 
-	data, err := json.Marshal(&user)
-	if err != nil {
-		return err
-	}
+		user.ID = r.store.nextUserID + 1
 
-	return r.store.Write(data, "user")
+		return r.store.writeUser(user)
+	})
 }
 
-func (r *UserRepository) FindByUUID(uuid string) (*model.User, error) {
-	users, err := r.store.ReadUsers()
-	if err != nil {
-		return nil, err
-	}
+func (r *UserRepository) FindByUUID(ctx context.Context, uuid string) (*model.User, error) {
+	defer r.store.rlock(r.tx)()
 
-	for _, v := range users {
-		if v.UUID == uuid {
-			return &v, nil
-		}
+	u, ok := r.store.index.userByUUID(uuid)
+	if !ok {
+		return nil, store.ErrUserNotFound
 	}
 
-	return nil, store.ErrUserNotFound
+	return &u, nil
 }
 
-func (r *UserRepository) FindByID(id int) (*model.User, error) {
-	users, err := r.store.ReadUsers()
-	if err != nil {
-		return nil, err
-	}
+func (r *UserRepository) FindByID(ctx context.Context, id int) (*model.User, error) {
+	defer r.store.rlock(r.tx)()
 
-	for _, v := range users {
-		if v.ID == id {
-			return &v, nil
-		}
+	u, ok := r.store.index.users[id]
+	if !ok {
+		return nil, store.ErrUserNotFound
 	}
 
-	return nil, store.ErrUserNotFound
+	return &u, nil
 }
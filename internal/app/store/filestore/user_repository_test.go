@@ -1,6 +1,7 @@
 package filestore_test
 
 import (
+	"context"
 	"errors"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
@@ -10,7 +11,7 @@ import (
 )
 
 func TestUserRepository(t *testing.T) {
-	st, err := filestore.New(filepath)
+	st, err := filestore.New(t.TempDir() + "/testfile.txt")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -20,7 +21,7 @@ func TestUserRepository(t *testing.T) {
 	user := model.TestUser(t)
 
 	assert.Condition(t, func() bool {
-		err := st.URL().Create(url)
+		err := st.URL().Create(context.Background(), url)
 		if errors.Is(err, store.ErrURLExist) {
 			return true
 		}
@@ -33,17 +34,17 @@ func TestUserRepository(t *testing.T) {
 
 	assert.NotNil(t, url.ID)
 
-	assert.NoError(t, st.User().Create(user))
+	assert.NoError(t, st.User().Create(context.Background(), user))
 	assert.NotNil(t, user.ID)
 
-	u, err := st.URL().FindByUUID(url.URLShort)
+	u, err := st.URL().FindByUUID(context.Background(), url.URLShort)
 	assert.NoError(t, err)
 	assert.Equal(t, url.URLOrigin, u.URLOrigin)
 
-	u2, err := st.URL().FindByID(url.ID)
+	u2, err := st.URL().FindByID(context.Background(), url.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, u, u2)
 
-	err = st.URL().UpdateUserID(url, user.ID)
+	err = st.URL().UpdateUserID(context.Background(), url, user.ID)
 	assert.NoError(t, err)
 }
@@ -0,0 +1,31 @@
+package store
+
+import (
+	"errors"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/shortcode"
+)
+
+// GenerateAttempts is how many codes a store tries for a url before it
+// gives up with ErrShortExist.
+const GenerateAttempts = 10
+
+// Generate gives the url a code made by gen, unless it has one already, and
+// calls create to store it. create is expected to fail with ErrShortExist
+// while the code is taken, then the next code is tried. A code the url came
+// with is tried once.
+func Generate(gen shortcode.Generator, url *model.URL, create func() error) error {
+	if url.URLShort != "" {
+		return create()
+	}
+
+	for attempt := 0; attempt < GenerateAttempts; attempt++ {
+		url.URLShort = gen.Generate(url.ID, attempt)
+
+		if err := create(); !errors.Is(err, ErrShortExist) {
+			return err
+		}
+	}
+
+	return ErrShortExist
+}
@@ -0,0 +1,142 @@
+package memstore_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/memstore"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+var benchSizes = []int{1000, 100000}
+
+// benchStore fills a store with n urls, the first ten of them belong to
+// user 1.
+func benchStore(b *testing.B, n int) (*memstore.Store, []*model.URL) {
+	b.Helper()
+
+	st := memstore.New()
+	ctx := context.Background()
+
+	urls := make([]*model.URL, n)
+	for i := range urls {
+		urls[i] = &model.URL{
+			URLOrigin: "https://example.com/" + strconv.Itoa(i),
+			URLShort:  "s" + strconv.Itoa(i),
+		}
+		if err := st.URL().Create(ctx, urls[i]); err != nil {
+			b.Fatal(err)
+		}
+		if i < 10 {
+			if err := st.URL().UpdateUserID(ctx, urls[i], 1); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	return st, urls
+}
+
+func BenchmarkURLRepository_FindByUUID(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("urls=%d", n), func(b *testing.B) {
+			st, urls := benchStore(b, n)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if _, err := st.URL().FindByUUID(ctx, urls[i%n].URLShort); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkURLRepository_Create(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("urls=%d", n), func(b *testing.B) {
+			st, _ := benchStore(b, n)
+			ctx := context.Background()
+			var next int64
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := strconv.FormatInt(atomic.AddInt64(&next, 1), 10)
+					url := &model.URL{URLOrigin: "https://example.org/" + i, URLShort: "b" + i}
+					if err := st.URL().Create(ctx, url); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkStore_WithTxCreate is Create as the handlers run it when deleted
+// urls are reused: a transaction holds every shard, so the creates take
+// turns.
+func BenchmarkStore_WithTxCreate(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("urls=%d", n), func(b *testing.B) {
+			st, _ := benchStore(b, n)
+			ctx := context.Background()
+			var next int64
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := strconv.FormatInt(atomic.AddInt64(&next, 1), 10)
+					url := &model.URL{URLOrigin: "https://example.org/" + i, URLShort: "t" + i}
+					err := st.WithTx(ctx, func(tx store.Store) error {
+						return tx.URL().Create(ctx, url)
+					})
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkURLRepository_CreateExisting(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("urls=%d", n), func(b *testing.B) {
+			st, urls := benchStore(b, n)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					url := &model.URL{URLOrigin: urls[i%n].URLOrigin, URLShort: "dup"}
+					_ = st.URL().Create(ctx, url)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkURLRepository_FindByUserID(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("urls=%d", n), func(b *testing.B) {
+			st, _ := benchStore(b, n)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := st.URL().FindByUserID(ctx, 1); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"sort"
+	"sync/atomic"
+)
+
+// ExportUsers copies the users shard by shard and calls fn without holding
+// any lock.
+func (s *Store) ExportUsers(ctx context.Context, fn func(user *model.User) error) error {
+	var users []model.User
+	for i, sh := range s.shards {
+		unlock := s.rlock(false, i)
+		for _, v := range sh.users {
+			users = append(users, v)
+		}
+		unlock()
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+
+	for i := range users {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(&users[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportURLs works like ExportUsers.
+func (s *Store) ExportURLs(ctx context.Context, fn func(url *model.URL) error) error {
+	var urls []model.URL
+	for i, sh := range s.shards {
+		unlock := s.rlock(false, i)
+		for _, v := range sh.urls {
+			urls = append(urls, v)
+		}
+		unlock()
+	}
+
+	sort.Slice(urls, func(i, j int) bool {
+		return urls[i].ID < urls[j].ID
+	})
+
+	for i := range urls {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(&urls[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportUsers holds every shard while the batch is stored.
+func (s *Store) ImportUsers(ctx context.Context, users []*model.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	defer s.lock(false, allShards()...)()
+
+	for _, user := range users {
+		if id, ok := s.shards[shardByKey(user.UUID)].usersByUUID[user.UUID]; ok && id != user.ID {
+			return fmt.Errorf("user %d: uuid %s belongs to user %d", user.ID, user.UUID, id)
+		}
+	}
+
+	for _, user := range users {
+		if old, ok := s.shards[shardByID(user.ID)].users[user.ID]; ok {
+			delete(s.shards[shardByKey(old.UUID)].usersByUUID, old.UUID)
+		}
+		s.insertUser(*user)
+		raise(&s.userNextID, user.ID)
+	}
+
+	return nil
+}
+
+// ImportURLs holds every shard while the batch is stored.
+func (s *Store) ImportURLs(ctx context.Context, urls []*model.URL) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	defer s.lock(false, allShards()...)()
+
+	for _, url := range urls {
+		key := s.Dedup.Key(url)
+		if id, ok := s.shards[shardByKey(key)].urlsByOrigin[key]; ok && id != url.ID {
+			return fmt.Errorf("url %d: %w: %s belongs to url %d", url.ID, store.ErrURLExist, url.URLOrigin, id)
+		}
+		if id, ok := s.shards[shardByKey(url.URLShort)].urlsByShort[url.URLShort]; ok && id != url.ID {
+			return fmt.Errorf("url %d: short code %s belongs to url %d", url.ID, url.URLShort, id)
+		}
+	}
+
+	for _, url := range urls {
+		if old, ok := s.shards[shardByID(url.ID)].urls[url.ID]; ok {
+			s.removeURL(old)
+		}
+		s.insertURL(*url)
+		raise(&s.urlNextID, url.ID)
+	}
+
+	return nil
+}
+
+func (s *Store) LastURLID(ctx context.Context) (int, error) {
+	return int(atomic.LoadInt64(&s.urlNextID)), ctx.Err()
+}
+
+func (s *Store) RaiseURLID(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	raise(&s.urlNextID, id)
+
+	return nil
+}
+
+// raise moves the ID counter up to id so that new records come after the
+// imported ones.
+func raise(counter *int64, id int) {
+	for {
+		current := atomic.LoadInt64(counter)
+		if current >= int64(id) || atomic.CompareAndSwapInt64(counter, current, int64(id)) {
+			return
+		}
+	}
+}
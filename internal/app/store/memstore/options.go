@@ -0,0 +1,14 @@
+package memstore
+
+import (
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+)
+
+type Option func(*Store)
+
+// WithOptions sets the settings shared by every store.
+func WithOptions(o store.Options) Option {
+	return func(s *Store) {
+		s.Options = o
+	}
+}
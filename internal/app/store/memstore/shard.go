@@ -0,0 +1,223 @@
+package memstore
+
+import (
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"sort"
+	"sync"
+	"time"
+)
+
+const shardCount = 32
+
+// shard holds the part of every map whose keys hash to it. A record and its
+// index entries usually live in different shards. urlsByOrigin is keyed by
+// the store.Dedup key of the url.
+type shard struct {
+	sync.RWMutex
+
+	urls         map[int]model.URL
+	urlsByShort  map[string]int
+	urlsByOrigin map[string]int
+	urlsByUser   map[int]map[int]struct{}
+
+	users       map[int]model.User
+	usersByUUID map[string]int
+}
+
+func newShard() *shard {
+	return &shard{
+		urls:         make(map[int]model.URL),
+		urlsByShort:  make(map[string]int),
+		urlsByOrigin: make(map[string]int),
+		urlsByUser:   make(map[int]map[int]struct{}),
+		users:        make(map[int]model.User),
+		usersByUUID:  make(map[string]int),
+	}
+}
+
+func shardByID(id int) int {
+	if id < 0 {
+		id = -id
+	}
+
+	return id % shardCount
+}
+
+// shardByKey hashes the key with FNV-1a.
+func shardByKey(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+
+	return int(h % shardCount)
+}
+
+func allShards() []int {
+	all := make([]int, shardCount)
+	for i := range all {
+		all[i] = i
+	}
+
+	return all
+}
+
+// lock write-locks the shards in ascending order, the order every caller
+// follows, and returns the matching unlock. A repository inside WithTx
+// takes nothing: the transaction already holds every shard.
+func (s *Store) lock(tx bool, shards ...int) func() {
+	if tx {
+		return func() {}
+	}
+
+	shards = ordered(shards)
+	for _, i := range shards {
+		s.shards[i].Lock()
+	}
+
+	return func() {
+		for _, i := range shards {
+			s.shards[i].Unlock()
+		}
+	}
+}
+
+// rlock read-locks a single shard, see lock.
+func (s *Store) rlock(tx bool, i int) func() {
+	if tx {
+		return func() {}
+	}
+	s.shards[i].RLock()
+
+	return s.shards[i].RUnlock
+}
+
+func ordered(shards []int) []int {
+	sort.Ints(shards)
+
+	result := shards[:0]
+	for i, v := range shards {
+		if i == 0 || v != shards[i-1] {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+// record remembers how to revert a change when it is made inside WithTx.
+// The caller must hold the shards the change touches.
+func (s *Store) record(undo func()) {
+	if s.journal != nil {
+		s.journal = append(s.journal, undo)
+	}
+}
+
+// The methods below change a record together with its index entries, the
+// caller must hold every shard involved.
+
+func (s *Store) urlShards(url model.URL) []int {
+	shards := []int{shardByID(url.ID), shardByKey(url.URLShort), shardByKey(s.Dedup.Key(&url))}
+	if url.UserID != 0 {
+		shards = append(shards, shardByID(url.UserID))
+	}
+
+	return shards
+}
+
+func (s *Store) insertURL(url model.URL) {
+	s.shards[shardByID(url.ID)].urls[url.ID] = url
+	s.shards[shardByKey(url.URLShort)].urlsByShort[url.URLShort] = url.ID
+	key := s.Dedup.Key(&url)
+	s.shards[shardByKey(key)].urlsByOrigin[key] = url.ID
+	s.addToUser(url.UserID, url.ID)
+
+	s.record(func() { s.removeURL(url) })
+}
+
+func (s *Store) removeURL(url model.URL) {
+	delete(s.shards[shardByID(url.ID)].urls, url.ID)
+	delete(s.shards[shardByKey(url.URLShort)].urlsByShort, url.URLShort)
+	key := s.Dedup.Key(&url)
+	delete(s.shards[shardByKey(key)].urlsByOrigin, key)
+	s.removeFromUser(url.UserID, url.ID)
+}
+
+// purgeURL removes a url like removeURL and can be reverted.
+func (s *Store) purgeURL(url model.URL) {
+	s.removeURL(url)
+
+	s.record(func() { s.insertURL(url) })
+}
+
+func (s *Store) setDeleted(id int, deleted bool, at *time.Time) {
+	sh := s.shards[shardByID(id)]
+	url := sh.urls[id]
+	prev, prevAt := url.IsDeleted, url.DeletedAt
+	url.IsDeleted, url.DeletedAt = deleted, at
+	sh.urls[id] = url
+
+	s.record(func() { s.setDeleted(id, prev, prevAt) })
+}
+
+// setUserID moves the url to another owner, with store.DedupUser its
+// original URL moves to the scope of the new owner.
+func (s *Store) setUserID(id int, userID int) {
+	sh := s.shards[shardByID(id)]
+	url := sh.urls[id]
+	prev := url.UserID
+
+	s.removeFromUser(prev, id)
+	key := s.Dedup.Key(&url)
+	delete(s.shards[shardByKey(key)].urlsByOrigin, key)
+
+	url.UserID = userID
+	sh.urls[id] = url
+
+	key = s.Dedup.Key(&url)
+	s.shards[shardByKey(key)].urlsByOrigin[key] = id
+	s.addToUser(userID, id)
+
+	s.record(func() { s.setUserID(id, prev) })
+}
+
+// The urls of nobody are not indexed, that entry would be shared by
+// almost every create.
+func (s *Store) addToUser(userID, id int) {
+	if userID == 0 {
+		return
+	}
+
+	sh := s.shards[shardByID(userID)]
+	ids, ok := sh.urlsByUser[userID]
+	if !ok {
+		ids = make(map[int]struct{})
+		sh.urlsByUser[userID] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func (s *Store) removeFromUser(userID, id int) {
+	if userID == 0 {
+		return
+	}
+
+	sh := s.shards[shardByID(userID)]
+	if ids, ok := sh.urlsByUser[userID]; ok {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(sh.urlsByUser, userID)
+		}
+	}
+}
+
+func (s *Store) insertUser(user model.User) {
+	s.shards[shardByID(user.ID)].users[user.ID] = user
+	s.shards[shardByKey(user.UUID)].usersByUUID[user.UUID] = user.ID
+
+	s.record(func() {
+		delete(s.shards[shardByID(user.ID)].users, user.ID)
+		delete(s.shards[shardByKey(user.UUID)].usersByUUID, user.UUID)
+	})
+}
@@ -1,31 +1,40 @@
 package memstore
 
 import (
-	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"context"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
-	"sync"
+	"sync/atomic"
 )
 
+// Store keeps everything in memory. The records and the indexes over them
+// are spread over shards by key and every shard has its own lock, so
+// requests for different keys do not wait for each other.
 type Store struct {
-	sync.RWMutex
+	shards     [shardCount]*shard
+	urlNextID  int64
+	userNextID int64
+	store.Options
 
-	urls       map[int]*model.URL
-	users      map[int]*model.User
-	urlNextID  int
-	userNextID int
+	// journal collects the undo steps of the running transaction
+	journal []func()
 }
 
 func (s *Store) Close() error {
 	return nil
 }
 
-func New() *Store {
-	return &Store{
-		urls:       make(map[int]*model.URL),
-		users:      make(map[int]*model.User),
-		urlNextID:  0,
-		userNextID: 0,
+func New(opts ...Option) *Store {
+	s := &Store{}
+	for i := range s.shards {
+		s.shards[i] = newShard()
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Options.Init()
+
+	return s
 }
 
 func (s *Store) URL() store.URLRepository {
@@ -36,6 +45,16 @@ func (s *Store) User() store.UserRepository {
 	return &UserRepository{store: s}
 }
 
-func (s *Store) Ping() error {
-	return nil
+func (s *Store) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// IDs are handed out before the shards are locked, so a create which turns
+// out to be a duplicate leaves a gap, as a database sequence would.
+func (s *Store) nextURLID() int {
+	return int(atomic.AddInt64(&s.urlNextID, 1))
+}
+
+func (s *Store) nextUserID() int {
+	return int(atomic.AddInt64(&s.userNextID, 1))
 }
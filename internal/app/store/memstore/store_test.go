@@ -0,0 +1,50 @@
+package memstore_test
+
+import (
+	"context"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/shortcode"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/memstore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/storetest"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return memstore.New()
+	})
+}
+
+func TestStoreDedupUser(t *testing.T) {
+	storetest.RunDedupUser(t, func(t *testing.T) store.Store {
+		return memstore.New(memstore.WithOptions(store.Options{Dedup: store.DedupUser}))
+	})
+}
+
+func TestStoreGenerator(t *testing.T) {
+	storetest.RunGenerator(t, func(t *testing.T, gen shortcode.Generator) store.Store {
+		return memstore.New(memstore.WithOptions(store.Options{Generator: gen}))
+	})
+}
+
+func TestStoreCaseInsensitive(t *testing.T) {
+	storetest.RunCaseInsensitive(t, func(t *testing.T, gen shortcode.Generator) store.Store {
+		return memstore.New(memstore.WithOptions(store.Options{Generator: gen, Case: store.CaseInsensitive}))
+	})
+}
+
+func TestStoreMaxURLLength(t *testing.T) {
+	ctx := context.Background()
+	url := model.TestURLGenerated(t)
+	url.URLOrigin += "?utm=" + strings.Repeat("x", 100)
+
+	st := memstore.New(memstore.WithOptions(store.Options{MaxURLLength: 64}))
+	assert.ErrorIs(t, st.URL().Create(ctx, url), model.ErrURLTooLong)
+
+	url.URLOrigin += strings.Repeat("x", model.DefaultMaxURLLength)
+	st = memstore.New(memstore.WithOptions(store.Options{MaxURLLength: -1}))
+	assert.NoError(t, st.URL().Create(ctx, url))
+}
@@ -0,0 +1,64 @@
+package memstore
+
+import (
+	"context"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+)
+
+// WithTx holds every shard while fn runs. Every change made through the
+// transaction records how to revert itself, the records are replayed
+// backwards if fn fails. IDs taken by the transaction are not given back.
+func (s *Store) WithTx(ctx context.Context, fn func(tx store.Store) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	unlock := s.lock(false, allShards()...)
+	defer unlock()
+
+	s.journal = []func(){}
+	committed := false
+	defer func() {
+		journal := s.journal
+		s.journal = nil
+		if !committed {
+			for i := len(journal) - 1; i >= 0; i-- {
+				journal[i]()
+			}
+		}
+	}()
+
+	if err := fn(&txStore{store: s}); err != nil {
+		return err
+	}
+	committed = true
+
+	return nil
+}
+
+// txStore is the view of the store handed to a WithTx callback.
+type txStore struct {
+	store *Store
+}
+
+func (t *txStore) URL() store.URLRepository {
+	return &URLRepository{store: t.store, tx: true}
+}
+
+func (t *txStore) User() store.UserRepository {
+	return &UserRepository{store: t.store, tx: true}
+}
+
+// WithTx joins the running transaction.
+func (t *txStore) WithTx(ctx context.Context, fn func(tx store.Store) error) error {
+	return fn(t)
+}
+
+func (t *txStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Close does nothing, the store is closed by its owner.
+func (t *txStore) Close() error {
+	return nil
+}
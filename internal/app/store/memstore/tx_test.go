@@ -0,0 +1,66 @@
+package memstore_test
+
+import (
+	"context"
+	"errors"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/memstore"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStoreWithTx(t *testing.T) {
+	st := memstore.New()
+	ctx := context.Background()
+
+	user := model.TestUser(t)
+	url := model.TestURLGenerated(t)
+
+	err := st.WithTx(ctx, func(tx store.Store) error {
+		if err := tx.User().Create(ctx, user); err != nil {
+			return err
+		}
+		if err := tx.URL().Create(ctx, url); err != nil {
+			return err
+		}
+
+		return tx.URL().UpdateUserID(ctx, url, user.ID)
+	})
+	assert.NoError(t, err)
+
+	u, err := st.URL().FindByUUID(ctx, url.URLShort)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, u.UserID)
+
+	errFailed := errors.New("failed")
+	other := model.TestURLGenerated(t)
+
+	err = st.WithTx(ctx, func(tx store.Store) error {
+		if err := tx.URL().Create(ctx, other); err != nil {
+			return err
+		}
+		if err := tx.URL().BatchDelete(ctx, []int{url.ID}); err != nil {
+			return err
+		}
+		if err := tx.URL().UpdateUserID(ctx, url, 0); err != nil {
+			return err
+		}
+
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+
+	_, err = st.URL().FindByUUID(ctx, other.URLShort)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	u, err = st.URL().FindByUUID(ctx, url.URLShort)
+	assert.NoError(t, err)
+	assert.False(t, u.IsDeleted)
+	assert.Equal(t, user.ID, u.UserID)
+
+	// the IDs taken by the transaction are not reused
+	next := model.TestURLGenerated(t)
+	assert.NoError(t, st.URL().Create(ctx, next))
+	assert.Greater(t, next.ID, other.ID)
+}
@@ -1,118 +1,348 @@
 package memstore
 
 import (
+	"context"
+	"errors"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"sort"
+	"time"
 )
 
 type URLRepository struct {
 	store *Store
+	tx    bool
 }
 
-func (r *URLRepository) IsDeleted(id int) bool {
-	r.store.RLock()
-	defer r.store.RUnlock()
+func (r *URLRepository) IsDeleted(ctx context.Context, id int) bool {
+	url, ok := r.get(id)
 
-	for _, v := range r.store.urls {
-		if id == v.ID {
-			return v.IsDeleted
+	return ok && url.IsDeleted
+}
+
+func (r *URLRepository) BatchDelete(ctx context.Context, ids []int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	shards := make([]int, len(ids))
+	for i, id := range ids {
+		shards[i] = shardByID(id)
+	}
+	defer r.store.lock(r.tx, shards...)()
+
+	now := model.Now()
+	for _, id := range ids {
+		if url, ok := r.store.shards[shardByID(id)].urls[id]; ok && !url.IsDeleted {
+			r.store.setDeleted(id, true, now)
 		}
 	}
 
-	return false
+	return nil
 }
 
-func (r *URLRepository) BatchDelete(ids []int) error {
-	r.store.Lock()
-	defer r.store.Unlock()
+// DeleteExpired holds every shard while the urls are scanned.
+func (r *URLRepository) DeleteExpired(ctx context.Context, now time.Time) ([]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	defer r.store.lock(r.tx, allShards()...)()
 
-	for i, v := range r.store.urls {
-		for _, k := range ids {
-			if k == v.ID {
-				r.store.urls[i].IsDeleted = true
+	at := model.Timestamp(&now)
+	var ids []int
+	for _, sh := range r.store.shards {
+		for id, url := range sh.urls {
+			if !url.IsDeleted && url.Expired(now) {
+				r.store.setDeleted(id, true, at)
+				ids = append(ids, id)
 			}
 		}
 	}
+	sort.Ints(ids)
 
-	return nil
+	return ids, nil
 }
 
-func (r *URLRepository) Delete(url *model.URL) error {
-	r.store.Lock()
-	defer r.store.Unlock()
+// Purge holds every shard, the shards of a url are only known once it is
+// found.
+func (r *URLRepository) Purge(ctx context.Context, ids []int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	defer r.store.lock(r.tx, allShards()...)()
 
-	url.IsDeleted = true
+	for _, id := range ids {
+		if url, ok := r.store.shards[shardByID(id)].urls[id]; ok && url.IsDeleted {
+			r.store.purgeURL(url)
+		}
+	}
 
 	return nil
 }
 
-func (r *URLRepository) Create(url *model.URL) error {
-	r.store.Lock()
-	defer r.store.Unlock()
-	if err := url.Validate(); err != nil {
-		return err
+func (r *URLRepository) PurgeDeleted(ctx context.Context, before time.Time) ([]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	for _, v := range r.store.urls {
-		if url.URLOrigin == v.URLOrigin {
-			*url = *v
-			return store.ErrURLExist
+	defer r.store.lock(r.tx, allShards()...)()
+
+	var urls []model.URL
+	for _, sh := range r.store.shards {
+		for _, url := range sh.urls {
+			if url.DeletedBy(before) {
+				urls = append(urls, url)
+			}
 		}
 	}
 
-	url.ID = r.store.urlNextID + 1
+	ids := make([]int, len(urls))
+	for i, url := range urls {
+		r.store.purgeURL(url)
+		ids[i] = url.ID
+	}
+	sort.Ints(ids)
+
+	return ids, nil
+}
+
+func (r *URLRepository) Delete(ctx context.Context, url *model.URL) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	defer r.store.lock(r.tx, shardByID(url.ID))()
+
+	v, ok := r.store.shards[shardByID(url.ID)].urls[url.ID]
+	if !ok {
+		return store.ErrRecordNotFound
+	}
 
-	r.store.urls[r.store.urlNextID] = url
-	r.store.urlNextID++
+	if !v.IsDeleted {
+		r.store.setDeleted(url.ID, true, model.Now())
+	}
 
 	return nil
 }
 
-func (r *URLRepository) FindByID(id int) (*model.URL, error) {
-	r.store.RLock()
-	defer r.store.RUnlock()
+func (r *URLRepository) Create(ctx context.Context, url *model.URL) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := url.Validate(r.store.MaxURLLength); err != nil {
+		return err
+	}
+	r.store.Case.FoldAll(url)
+
+	v := *url
+	v.ID = r.store.nextURLID()
+
+	err := store.Generate(r.store.Generator, &v, func() error {
+		// the shard of the original URL is what keeps two creates of the
+		// same URL apart
+		key := r.store.Dedup.Key(&v)
+		unlock := r.store.lock(r.tx, r.store.urlShards(v)...)
+		id, exists := r.store.shards[shardByKey(key)].urlsByOrigin[key]
+		_, taken := r.store.shards[shardByKey(v.URLShort)].urlsByShort[v.URLShort]
+		if !exists && !taken {
+			r.store.insertURL(v)
+		}
+		unlock()
 
-	for _, v := range r.store.urls {
-		if id == v.ID {
-			return v, nil
+		if exists {
+			v, _ = r.get(id)
+			return store.ErrURLExist
+		}
+		if taken {
+			return store.ErrShortExist
 		}
+
+		return nil
+	})
+	if err == nil || errors.Is(err, store.ErrURLExist) {
+		*url = v
 	}
 
-	return nil, store.ErrRecordNotFound
+	return err
 }
 
-func (r *URLRepository) FindByUUID(uuid string) (*model.URL, error) {
-	r.store.RLock()
-	defer r.store.RUnlock()
+// BatchCreate holds every shard, the batch is inserted as a whole.
+func (r *URLRepository) BatchCreate(ctx context.Context, urls []*model.URL) ([]bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	for _, v := range r.store.urls {
-		if v.URLShort == uuid {
-			return v, nil
+	for _, url := range urls {
+		if err := url.Validate(r.store.MaxURLLength); err != nil {
+			return nil, err
 		}
 	}
+	r.store.Case.FoldAll(urls...)
+
+	defer r.store.lock(r.tx, allShards()...)()
+
+	created := make([]bool, len(urls))
+	added := make(map[string]*model.URL)
+	shorts := make(map[string]bool)
 
-	return nil, store.ErrRecordNotFound
+	for i, url := range urls {
+		key := r.store.Dedup.Key(url)
+		if id, ok := r.store.shards[shardByKey(key)].urlsByOrigin[key]; ok {
+			*url = r.store.shards[shardByID(id)].urls[id]
+			continue
+		}
+		if v, ok := added[key]; ok {
+			*url = *v
+			continue
+		}
+
+		url.ID = r.store.nextURLID()
+		err := store.Generate(r.store.Generator, url, func() error {
+			if _, ok := r.store.shards[shardByKey(url.URLShort)].urlsByShort[url.URLShort]; ok || shorts[url.URLShort] {
+				return store.ErrShortExist
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		added[key] = url
+		shorts[url.URLShort] = true
+		created[i] = true
+	}
+
+	for i, url := range urls {
+		if created[i] {
+			r.store.insertURL(*url)
+		}
+	}
+
+	return created, nil
+}
+
+func (r *URLRepository) FindByID(ctx context.Context, id int) (*model.URL, error) {
+	url, ok := r.get(id)
+	if !ok {
+		return nil, store.ErrRecordNotFound
+	}
+
+	return &url, nil
+}
+
+func (r *URLRepository) FindByUUID(ctx context.Context, uuid string) (*model.URL, error) {
+	return r.store.Case.Find(uuid, func(short string) (*model.URL, error) {
+		return r.findByUUID(ctx, short)
+	})
 }
 
-func (r *URLRepository) FindByUserID(id int) ([]*model.URL, error) {
-	r.store.RLock()
-	defer r.store.RUnlock()
+func (r *URLRepository) findByUUID(ctx context.Context, uuid string) (*model.URL, error) {
+	i := shardByKey(uuid)
+
+	unlock := r.store.rlock(r.tx, i)
+	id, ok := r.store.shards[i].urlsByShort[uuid]
+	unlock()
+
+	if !ok {
+		return nil, store.ErrRecordNotFound
+	}
+
+	return r.FindByID(ctx, id)
+}
 
+// FindByUserID looks the user up in the index. The urls of nobody are not
+// indexed and are collected from every shard.
+func (r *URLRepository) FindByUserID(ctx context.Context, id int) ([]*model.URL, error) {
 	var result []*model.URL
 
-	for _, v := range r.store.urls {
-		if v.UserID == id {
-			result = append(result, v)
+	if id == 0 {
+		for i, sh := range r.store.shards {
+			unlock := r.store.rlock(r.tx, i)
+			for _, v := range sh.urls {
+				if v.UserID == 0 {
+					v := v
+					result = append(result, &v)
+				}
+			}
+			unlock()
+		}
+	} else {
+		i := shardByID(id)
+
+		unlock := r.store.rlock(r.tx, i)
+		ids := make([]int, 0, len(r.store.shards[i].urlsByUser[id]))
+		for v := range r.store.shards[i].urlsByUser[id] {
+			ids = append(ids, v)
+		}
+		unlock()
+
+		for _, v := range ids {
+			if url, ok := r.get(v); ok && url.UserID == id {
+				result = append(result, &url)
+			}
 		}
 	}
 
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
 	return result, nil
 }
 
-func (r *URLRepository) UpdateUserID(url *model.URL, userID int) error {
-	r.store.Lock()
-	url.UserID = userID
-	r.store.Unlock()
+func (r *URLRepository) FindByUserIDPage(ctx context.Context, id int, q store.URLQuery) ([]*model.URL, error) {
+	urls, _ := r.FindByUserID(ctx, id)
 
-	return nil
+	return q.Page(urls), nil
+}
+
+func (r *URLRepository) UpdateUserID(ctx context.Context, url *model.URL, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// the current owner decides which shards have to be locked, it is read
+	// first and checked again under the locks
+	for {
+		v, ok := r.get(url.ID)
+		if !ok {
+			return store.ErrRecordNotFound
+		}
+
+		moved := v
+		moved.UserID = userID
+		from, to := r.store.Dedup.Key(&v), r.store.Dedup.Key(&moved)
+
+		unlock := r.store.lock(r.tx, shardByID(url.ID), shardByID(v.UserID), shardByID(userID), shardByKey(from), shardByKey(to))
+		current := r.store.shards[shardByID(url.ID)].urls[url.ID]
+		if current.UserID != v.UserID {
+			unlock()
+			continue
+		}
+
+		if current.UserID != userID {
+			if id, ok := r.store.shards[shardByKey(to)].urlsByOrigin[to]; ok && id != url.ID {
+				unlock()
+				return store.ErrURLExist
+			}
+			r.store.setUserID(url.ID, userID)
+		}
+		unlock()
+
+		url.UserID = userID
+
+		return nil
+	}
+}
+
+func (r *URLRepository) get(id int) (model.URL, bool) {
+	i := shardByID(id)
+	defer r.store.rlock(r.tx, i)()
+
+	url, ok := r.store.shards[i].urls[id]
+
+	return url, ok
 }
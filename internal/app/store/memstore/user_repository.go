@@ -1,48 +1,59 @@
 package memstore
 
 import (
+	"context"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
 )
 
 type UserRepository struct {
 	store *Store
+	tx    bool
 }
 
-func (r *UserRepository) Create(user *model.User) error {
-	r.store.Lock()
-	defer r.store.Unlock()
+func (r *UserRepository) Create(ctx context.Context, user *model.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	v := *user
+	v.ID = r.store.nextUserID()
 
-	user.ID = r.store.userNextID + 1
+	defer r.store.lock(r.tx, shardByID(v.ID), shardByKey(v.UUID))()
 
-	r.store.users[r.store.userNextID] = user
-	r.store.userNextID++
+	if id, ok := r.store.shards[shardByKey(v.UUID)].usersByUUID[v.UUID]; ok {
+		user.ID = id
+		return nil
+	}
+
+	r.store.insertUser(v)
+	user.ID = v.ID
 
 	return nil
 }
 
-func (r *UserRepository) FindByID(id int) (*model.User, error) {
-	r.store.Lock()
-	defer r.store.Unlock()
+func (r *UserRepository) FindByID(ctx context.Context, id int) (*model.User, error) {
+	i := shardByID(id)
+	defer r.store.rlock(r.tx, i)()
 
-	for _, v := range r.store.users {
-		if id == v.ID {
-			return v, nil
-		}
+	u, ok := r.store.shards[i].users[id]
+	if !ok {
+		return nil, store.ErrUserNotFound
 	}
 
-	return nil, store.ErrUserNotFound
+	return &u, nil
 }
 
-func (r *UserRepository) FindByUUID(uuid string) (*model.User, error) {
-	r.store.Lock()
-	defer r.store.Unlock()
+func (r *UserRepository) FindByUUID(ctx context.Context, uuid string) (*model.User, error) {
+	i := shardByKey(uuid)
+
+	unlock := r.store.rlock(r.tx, i)
+	id, ok := r.store.shards[i].usersByUUID[uuid]
+	unlock()
 
-	for _, v := range r.store.users {
-		if uuid == v.UUID {
-			return v, nil
-		}
+	if !ok {
+		return nil, store.ErrUserNotFound
 	}
 
-	return &model.User{}, store.ErrUserNotFound
+	return r.FindByID(ctx, id)
 }
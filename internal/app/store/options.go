@@ -0,0 +1,33 @@
+package store
+
+import (
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/shortcode"
+)
+
+// Options are the settings every store takes. The zero value keeps a url
+// per original URL and makes random, case sensitive codes.
+type Options struct {
+	// Dedup is the scope in which an original URL is unique.
+	Dedup Dedup
+	// Generator makes the codes of the urls created without one, random
+	// codes of shortcode.DefaultLength when it is nil.
+	Generator shortcode.Generator
+	// Case tells whether the codes are told apart by case.
+	Case Case
+	// MaxURLLength is the longest original URL accepted,
+	// model.DefaultMaxURLLength when zero and any when negative.
+	MaxURLLength int
+}
+
+// Init fills in the defaults and has the generator make the codes as they
+// are stored. A store calls it once, after its options are applied.
+func (o *Options) Init() {
+	if o.Generator == nil {
+		o.Generator = shortcode.NewRandom(shortcode.DefaultLength, shortcode.Base62)
+	}
+	o.Generator = o.Case.Generator(o.Generator)
+	if o.MaxURLLength == 0 {
+		o.MaxURLLength = model.DefaultMaxURLLength
+	}
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"sort"
+	"strings"
+)
+
+// URLSort is the order of a page of urls.
+type URLSort int
+
+const (
+	// SortByCreation orders the urls by ID, that is in the order they were
+	// created.
+	SortByCreation URLSort = iota
+	// SortByShort orders the urls by the short code.
+	SortByShort
+)
+
+// URLQuery selects a page of the urls of a user.
+type URLQuery struct {
+	// Limit is the page size, zero means no limit.
+	Limit int
+	Sort  URLSort
+	Desc  bool
+	// After is the last url of the previous page, only its ID and short code
+	// are used. The first page is requested with nil.
+	After *model.URL
+
+	ExcludeDeleted bool
+	// OriginContains keeps only the urls whose original URL contains it.
+	OriginContains string
+}
+
+// Match reports whether the url passes the filters of the query.
+func (q URLQuery) Match(url *model.URL) bool {
+	if q.ExcludeDeleted && url.IsDeleted {
+		return false
+	}
+
+	return strings.Contains(url.URLOrigin, q.OriginContains)
+}
+
+// Less reports whether a comes before b in the order of the query.
+func (q URLQuery) Less(a, b *model.URL) bool {
+	if q.Desc {
+		a, b = b, a
+	}
+
+	if q.Sort == SortByShort {
+		return a.URLShort < b.URLShort
+	}
+
+	return a.ID < b.ID
+}
+
+// Page filters, sorts and cuts urls the way the query asks. It is meant for
+// the stores which keep everything in memory.
+func (q URLQuery) Page(urls []*model.URL) []*model.URL {
+	result := make([]*model.URL, 0, len(urls))
+	for _, url := range urls {
+		if !q.Match(url) {
+			continue
+		}
+		if q.After != nil && !q.Less(q.After, url) {
+			continue
+		}
+		result = append(result, url)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return q.Less(result[i], result[j])
+	})
+
+	if q.Limit > 0 && len(result) > q.Limit {
+		result = result[:q.Limit]
+	}
+
+	return result
+}
@@ -1,20 +1,47 @@
 package store
 
-import "github.com/iryzzh/practicum-go-shortener/internal/app/model"
+import (
+	"context"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"time"
+)
 
 type URLRepository interface {
-	Create(url *model.URL) error
-	Delete(url *model.URL) error
-	BatchDelete(ids []int) error
-	FindByID(id int) (*model.URL, error)
-	FindByUUID(uuid string) (*model.URL, error)
-	FindByUserID(id int) ([]*model.URL, error)
-	UpdateUserID(url *model.URL, userID int) error
-	IsDeleted(id int) bool
+	// Create stores the url for its owner. If the original URL is already
+	// there in the Dedup scope of the store, url is filled with the stored
+	// record and ErrURLExist is returned. Otherwise a short code which
+	// another url has already fails with ErrShortExist.
+	Create(ctx context.Context, url *model.URL) error
+	// BatchCreate creates all urls or none of them. A url whose original URL
+	// already exists in its scope is filled with the stored record and
+	// reported as not created. A short code of the new urls which is taken,
+	// by a stored url or another one of the batch, fails the batch with
+	// ErrShortExist.
+	BatchCreate(ctx context.Context, urls []*model.URL) (created []bool, err error)
+	Delete(ctx context.Context, url *model.URL) error
+	BatchDelete(ctx context.Context, ids []int) error
+	// DeleteExpired marks the urls which have expired by now as deleted and
+	// returns their IDs.
+	DeleteExpired(ctx context.Context, now time.Time) ([]int, error)
+	// Purge removes the deleted urls among ids for good, which frees their
+	// original URLs and short codes. Other urls are left alone.
+	Purge(ctx context.Context, ids []int) error
+	// PurgeDeleted purges the urls deleted at or before the given time and
+	// returns their IDs.
+	PurgeDeleted(ctx context.Context, before time.Time) ([]int, error)
+	FindByID(ctx context.Context, id int) (*model.URL, error)
+	FindByUUID(ctx context.Context, uuid string) (*model.URL, error)
+	FindByUserID(ctx context.Context, id int) ([]*model.URL, error)
+	// FindByUserIDPage returns a single page of the urls of the user.
+	FindByUserIDPage(ctx context.Context, id int, q URLQuery) ([]*model.URL, error)
+	// UpdateUserID hands the url over to another user. With DedupUser it
+	// fails with ErrURLExist if that user has the original URL already.
+	UpdateUserID(ctx context.Context, url *model.URL, userID int) error
+	IsDeleted(ctx context.Context, id int) bool
 }
 
 type UserRepository interface {
-	Create(user *model.User) error
-	FindByUUID(uuid string) (*model.User, error)
-	FindByID(id int) (*model.User, error)
+	Create(ctx context.Context, user *model.User) error
+	FindByUUID(ctx context.Context, uuid string) (*model.User, error)
+	FindByID(ctx context.Context, id int) (*model.User, error)
 }
@@ -0,0 +1,8 @@
+//go:build cgo
+
+package sqlitestore
+
+import _ "github.com/mattn/go-sqlite3"
+
+// supported tells whether the driver is built in, it needs cgo.
+const supported = true
@@ -0,0 +1,5 @@
+//go:build !cgo
+
+package sqlitestore
+
+const supported = false
@@ -0,0 +1,133 @@
+package sqlitestore
+
+import (
+	"context"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/pkg/errors"
+)
+
+func (s *Store) ExportUsers(ctx context.Context, fn func(user *model.User) error) error {
+	rows, err := s.conn().QueryContext(ctx, "SELECT user_id, uuid FROM users ORDER BY user_id")
+	if err != nil {
+		return errors.Wrap(err, "query")
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var user model.User
+		if err := rows.Scan(&user.ID, &user.UUID); err != nil {
+			return errors.Wrap(err, "scan rows")
+		}
+		if err := fn(&user); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *Store) ExportURLs(ctx context.Context, fn func(url *model.URL) error) error {
+	rows, err := s.conn().QueryContext(ctx, "SELECT "+urlColumns+" FROM urls ORDER BY url_id")
+	if err != nil {
+		return errors.Wrap(err, "query")
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return errors.Wrap(err, "scan rows")
+		}
+		if err := fn(url); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ImportUsers upserts the batch in one transaction. AUTOINCREMENT keeps
+// counting after the largest imported ID on its own.
+func (s *Store) ImportUsers(ctx context.Context, users []*model.User) error {
+	return s.withTx(ctx, func(tx *Store) error {
+		stmt, err := tx.tx.PrepareContext(
+			ctx,
+			"INSERT INTO users (user_id, uuid) VALUES (?, ?) ON CONFLICT (user_id) DO UPDATE SET uuid = excluded.uuid",
+		)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, user := range users {
+			if _, err := stmt.ExecContext(ctx, user.ID, user.UUID); err != nil {
+				return errors.Wrapf(err, "user %d", user.ID)
+			}
+		}
+
+		return nil
+	})
+}
+
+// ImportURLs works like ImportUsers.
+func (s *Store) ImportURLs(ctx context.Context, urls []*model.URL) error {
+	return s.withTx(ctx, func(tx *Store) error {
+		stmt, err := tx.tx.PrepareContext(
+			ctx,
+			`INSERT INTO urls (url_id, user_id, original_url, short_url, is_deleted, expires_at, deleted_at, dedup_user_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (url_id) DO UPDATE SET
+		user_id = excluded.user_id,
+		original_url = excluded.original_url,
+		short_url = excluded.short_url,
+		is_deleted = excluded.is_deleted,
+		expires_at = excluded.expires_at,
+		deleted_at = excluded.deleted_at,
+		dedup_user_id = excluded.dedup_user_id`,
+		)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, url := range urls {
+			if _, err := stmt.ExecContext(ctx, url.ID, url.UserID, url.URLOrigin, url.URLShort, url.IsDeleted, url.ExpiresAt, url.DeletedAt, tx.Dedup.Owner(url)); err != nil {
+				return errors.Wrapf(err, "url %d", url.ID)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *Store) LastURLID(ctx context.Context) (int, error) {
+	var id int
+	err := s.conn().QueryRowContext(
+		ctx,
+		"SELECT COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'urls'), 0)",
+	).Scan(&id)
+
+	return id, err
+}
+
+// RaiseURLID moves the AUTOINCREMENT counter of urls, whose row is only
+// there once a url has been inserted.
+func (s *Store) RaiseURLID(ctx context.Context, id int) error {
+	return s.withTx(ctx, func(tx *Store) error {
+		if _, err := tx.tx.ExecContext(
+			ctx,
+			"UPDATE sqlite_sequence SET seq = ? WHERE name = 'urls' AND seq < ?",
+			id,
+			id,
+		); err != nil {
+			return err
+		}
+
+		_, err := tx.tx.ExecContext(
+			ctx,
+			"INSERT INTO sqlite_sequence (name, seq) SELECT 'urls', ? WHERE NOT EXISTS (SELECT 1 FROM sqlite_sequence WHERE name = 'urls')",
+			id,
+		)
+
+		return err
+	})
+}
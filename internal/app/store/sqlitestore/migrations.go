@@ -0,0 +1,89 @@
+package sqlitestore
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/iryzzh/practicum-go-shortener/db/migrations"
+)
+
+// withMigrate runs fn with a migrate instance on top of the store's pool.
+// The instance is not closed since closing the sqlite3 driver would close the
+// pool itself, only the source is released.
+func (s *Store) withMigrate(ctx context.Context, fn func(m *migrate.Migrate) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	src, err := iofs.New(migrations.SQLite, "sqlite")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	driver, err := sqlite3.WithInstance(s.db, &sqlite3.Config{})
+	if err != nil {
+		return err
+	}
+
+	m, err := migrate.NewWithInstance("iofs", src, "sqlite3", driver)
+	if err != nil {
+		return err
+	}
+
+	return fn(m)
+}
+
+// MigrateUp applies all pending migrations.
+func (s *Store) MigrateUp(ctx context.Context) error {
+	return s.withMigrate(ctx, func(m *migrate.Migrate) error {
+		if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// MigrateDown rolls back the given number of migrations, all of them if
+// steps is not positive.
+func (s *Store) MigrateDown(ctx context.Context, steps int) error {
+	return s.withMigrate(ctx, func(m *migrate.Migrate) error {
+		var err error
+		if steps > 0 {
+			err = m.Steps(-steps)
+		} else {
+			err = m.Down()
+		}
+		if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// MigrationVersion returns the current schema version, zero when no
+// migration has been applied yet.
+func (s *Store) MigrationVersion(ctx context.Context) (version uint, dirty bool, err error) {
+	err = s.withMigrate(ctx, func(m *migrate.Migrate) error {
+		version, dirty, err = m.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			return nil
+		}
+
+		return err
+	})
+
+	return version, dirty, err
+}
+
+// MigrateForce sets the schema version without running migrations, it is
+// used to recover from a failed migration that left the schema dirty.
+func (s *Store) MigrateForce(ctx context.Context, version int) error {
+	return s.withMigrate(ctx, func(m *migrate.Migrate) error {
+		return m.Force(version)
+	})
+}
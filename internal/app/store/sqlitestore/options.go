@@ -0,0 +1,21 @@
+package sqlitestore
+
+import (
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+)
+
+type Option func(*Store)
+
+// WithAutoMigrate tells New whether to apply pending migrations, it does so
+// by default.
+func WithAutoMigrate(enabled bool) Option {
+	return func(s *Store) {
+		s.autoMigrate = enabled
+	}
+}
+
+func WithOptions(o store.Options) Option {
+	return func(s *Store) {
+		s.Options = o
+	}
+}
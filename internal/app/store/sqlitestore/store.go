@@ -0,0 +1,128 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// ErrUnsupported is returned by New in a binary built without cgo, which the
+// SQLite driver needs.
+var ErrUnsupported = errors.New("sqlite is not supported by a binary built without cgo")
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Store keeps the data in a single SQLite file. SQLite allows one writer at
+// a time, so the pool is limited to a single connection and statements are
+// serialized by database/sql instead of failing with "database is locked".
+type Store struct {
+	db          *sql.DB
+	tx          *sql.Tx
+	autoMigrate bool
+	store.Options
+}
+
+func New(path string, opts ...Option) (*Store, error) {
+	if !supported {
+		return nil, ErrUnsupported
+	}
+
+	db, err := sql.Open("sqlite3", dsn(path))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	s := &Store{
+		db:          db,
+		autoMigrate: true,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Options.Init()
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if s.autoMigrate {
+		if err := s.MigrateUp(context.Background()); err != nil {
+			db.Close()
+			return nil, errors.Wrap(err, "migrate")
+		}
+	}
+
+	return s, nil
+}
+
+// dsn adds the connection parameters unless the path already has its own.
+func dsn(path string) string {
+	if strings.Contains(path, "?") {
+		return path
+	}
+
+	return "file:" + path + "?_busy_timeout=5000&_journal_mode=WAL"
+}
+
+func (s *Store) Close() error {
+	if s.tx != nil {
+		return nil
+	}
+
+	return s.db.Close()
+}
+
+func (s *Store) conn() querier {
+	if s.tx != nil {
+		return s.tx
+	}
+
+	return s.db
+}
+
+func (s *Store) WithTx(ctx context.Context, fn func(tx store.Store) error) error {
+	return s.withTx(ctx, func(tx *Store) error {
+		return fn(tx)
+	})
+}
+
+func (s *Store) withTx(ctx context.Context, fn func(tx *Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&Store{db: s.db, tx: tx, Options: s.Options}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) URL() store.URLRepository {
+	return &URLRepository{store: s}
+}
+
+func (s *Store) User() store.UserRepository {
+	return &UserRepository{store: s}
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
@@ -0,0 +1,33 @@
+package sqlitestore_test
+
+import (
+	"github.com/iryzzh/practicum-go-shortener/internal/app/shortcode"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/sqlitestore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/storetest"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return sqlitestore.TestStore(t)
+	})
+}
+
+func TestStoreDedupUser(t *testing.T) {
+	storetest.RunDedupUser(t, func(t *testing.T) store.Store {
+		return sqlitestore.TestStore(t, sqlitestore.WithOptions(store.Options{Dedup: store.DedupUser}))
+	})
+}
+
+func TestStoreGenerator(t *testing.T) {
+	storetest.RunGenerator(t, func(t *testing.T, gen shortcode.Generator) store.Store {
+		return sqlitestore.TestStore(t, sqlitestore.WithOptions(store.Options{Generator: gen}))
+	})
+}
+
+func TestStoreCaseInsensitive(t *testing.T) {
+	storetest.RunCaseInsensitive(t, func(t *testing.T, gen shortcode.Generator) store.Store {
+		return sqlitestore.TestStore(t, sqlitestore.WithOptions(store.Options{Generator: gen, Case: store.CaseInsensitive}))
+	})
+}
@@ -0,0 +1,24 @@
+package sqlitestore
+
+import "testing"
+
+// TestStore opens a store in a temporary directory, it is closed when the
+// test finishes. The test is skipped without cgo.
+func TestStore(t *testing.T, opts ...Option) *Store {
+	t.Helper()
+
+	if !supported {
+		t.Skip("sqlite needs cgo")
+	}
+
+	s, err := New(t.TempDir()+"/test.db", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		s.Close()
+	})
+
+	return s
+}
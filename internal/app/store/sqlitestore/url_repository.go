@@ -0,0 +1,424 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	urlColumns = "url_id, user_id, original_url, short_url, is_deleted, expires_at, deleted_at"
+
+	// dedup_user_id is the store.Dedup owner of the url, original_url is
+	// unique together with it. The original url is looked for before, so
+	// a conflict is on the short code.
+	insertURL = `INSERT INTO urls (url_id, user_id, original_url, short_url, expires_at, dedup_user_id) VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT DO NOTHING`
+)
+
+// scanner is implemented by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanURL(row scanner) (*model.URL, error) {
+	var (
+		url       model.URL
+		expiresAt sql.NullTime
+		deletedAt sql.NullTime
+	)
+
+	if err := row.Scan(&url.ID, &url.UserID, &url.URLOrigin, &url.URLShort, &url.IsDeleted, &expiresAt, &deletedAt); err != nil {
+		return nil, err
+	}
+	url.ExpiresAt = nullTime(expiresAt)
+	url.DeletedAt = nullTime(deletedAt)
+
+	return &url, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	v := t.Time.UTC()
+
+	return &v
+}
+
+type URLRepository struct {
+	store *Store
+}
+
+func (r *URLRepository) IsDeleted(ctx context.Context, id int) bool {
+	var isDeleted bool
+
+	err := r.store.conn().QueryRowContext(
+		ctx,
+		"SELECT is_deleted FROM urls WHERE url_id = ?",
+		id,
+	).Scan(&isDeleted)
+	if err != nil {
+		return false
+	}
+
+	return isDeleted
+}
+
+func (r *URLRepository) BatchDelete(ctx context.Context, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, len(ids)+1)
+	args[0] = model.Now()
+	for i, id := range ids {
+		args[i+1] = id
+	}
+
+	_, err := r.store.conn().ExecContext(
+		ctx,
+		"UPDATE urls SET is_deleted = TRUE, deleted_at = ? WHERE NOT is_deleted AND url_id IN (?"+strings.Repeat(", ?", len(ids)-1)+")",
+		args...,
+	)
+
+	return err
+}
+
+// DeleteExpired compares the expiry as text, which sorts like the instants
+// it stands for as long as every one of them is in UTC.
+func (r *URLRepository) DeleteExpired(ctx context.Context, now time.Time) ([]int, error) {
+	rows, err := r.store.conn().QueryContext(
+		ctx,
+		"UPDATE urls SET is_deleted = TRUE, deleted_at = ? WHERE NOT is_deleted AND expires_at <= ? RETURNING url_id",
+		model.Timestamp(&now),
+		now.UTC(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "update")
+	}
+
+	return scanIDs(rows)
+}
+
+// Purge removes the rows which are deleted among ids.
+func (r *URLRepository) Purge(ctx context.Context, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	_, err := r.store.conn().ExecContext(
+		ctx,
+		"DELETE FROM urls WHERE is_deleted AND url_id IN (?"+strings.Repeat(", ?", len(ids)-1)+")",
+		args...,
+	)
+
+	return err
+}
+
+// PurgeDeleted compares the times as text like DeleteExpired does.
+func (r *URLRepository) PurgeDeleted(ctx context.Context, before time.Time) ([]int, error) {
+	rows, err := r.store.conn().QueryContext(
+		ctx,
+		"DELETE FROM urls WHERE is_deleted AND (deleted_at IS NULL OR deleted_at <= ?) RETURNING url_id",
+		before.UTC(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "delete")
+	}
+
+	return scanIDs(rows)
+}
+
+// scanIDs reads the url IDs returned by a statement and sorts them.
+func scanIDs(rows *sql.Rows) ([]int, error) {
+	defer func() { _ = rows.Close() }()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "scan rows")
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Ints(ids)
+
+	return ids, nil
+}
+
+func (r *URLRepository) Delete(ctx context.Context, url *model.URL) error {
+	res, err := r.store.conn().ExecContext(
+		ctx,
+		"UPDATE urls SET deleted_at = CASE WHEN is_deleted THEN deleted_at ELSE ? END, is_deleted = TRUE WHERE url_id = ?",
+		model.Now(),
+		url.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return expectRow(res)
+}
+
+func (r *URLRepository) Create(ctx context.Context, url *model.URL) error {
+	if err := url.Validate(r.store.MaxURLLength); err != nil {
+		return err
+	}
+	r.store.Case.FoldAll(url)
+
+	return r.store.withTx(ctx, func(tx *Store) error {
+		created, err := (&URLRepository{store: tx}).create(ctx, url)
+		if err != nil {
+			return err
+		}
+		if !created {
+			return store.ErrURLExist
+		}
+
+		return nil
+	})
+}
+
+// BatchCreate inserts the urls one by one inside a single transaction.
+func (r *URLRepository) BatchCreate(ctx context.Context, urls []*model.URL) ([]bool, error) {
+	for _, url := range urls {
+		if err := url.Validate(r.store.MaxURLLength); err != nil {
+			return nil, err
+		}
+	}
+	r.store.Case.FoldAll(urls...)
+
+	created := make([]bool, len(urls))
+
+	err := r.store.withTx(ctx, func(tx *Store) error {
+		repo := &URLRepository{store: tx}
+		for i, url := range urls {
+			var err error
+			if created[i], err = repo.create(ctx, url); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// create stores url under the next ID unless its original URL is there
+// already; then url is set to the stored one and false is returned. r is
+// bound to a transaction, which holds the only connection, so nobody takes
+// the ID in between.
+func (r *URLRepository) create(ctx context.Context, url *model.URL) (bool, error) {
+	tx := r.store.tx
+
+	existing, err := r.find(ctx, tx, "dedup_user_id = ? AND original_url = ?", r.store.Dedup.Owner(url), url.URLOrigin)
+	if err == nil {
+		*url = *existing
+		return false, nil
+	}
+	if !errors.Is(err, store.ErrRecordNotFound) {
+		return false, err
+	}
+
+	v := *url
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT COALESCE((SELECT seq FROM sqlite_sequence WHERE name = 'urls'), 0) + 1",
+	).Scan(&v.ID)
+	if err != nil {
+		return false, errors.Wrap(err, "next id")
+	}
+
+	err = store.Generate(r.store.Generator, &v, func() error {
+		res, err := tx.ExecContext(ctx, insertURL, v.ID, v.UserID, v.URLOrigin, v.URLShort, v.ExpiresAt, r.store.Dedup.Owner(&v))
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return store.ErrShortExist
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	*url = v
+
+	return true, nil
+}
+
+func (r *URLRepository) FindByID(ctx context.Context, id int) (*model.URL, error) {
+	return r.find(ctx, r.store.conn(), "url_id = ?", id)
+}
+
+func (r *URLRepository) FindByUUID(ctx context.Context, uuid string) (*model.URL, error) {
+	return r.store.Case.Find(uuid, func(short string) (*model.URL, error) {
+		return r.findByUUID(ctx, short)
+	})
+}
+
+func (r *URLRepository) findByUUID(ctx context.Context, uuid string) (*model.URL, error) {
+	return r.find(ctx, r.store.conn(), "short_url = ?", uuid)
+}
+
+func (r *URLRepository) find(ctx context.Context, q querier, where string, args ...interface{}) (*model.URL, error) {
+	u, err := scanURL(q.QueryRowContext(
+		ctx,
+		"SELECT "+urlColumns+" FROM urls WHERE "+where,
+		args...,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (r *URLRepository) FindByUserID(ctx context.Context, id int) ([]*model.URL, error) {
+	return r.list(ctx, "SELECT "+urlColumns+" FROM urls WHERE user_id = ? ORDER BY url_id", id)
+}
+
+func (r *URLRepository) FindByUserIDPage(ctx context.Context, id int, q store.URLQuery) ([]*model.URL, error) {
+	where := []string{"user_id = ?"}
+	args := []interface{}{id}
+
+	if q.ExcludeDeleted {
+		where = append(where, "NOT is_deleted")
+	}
+	if q.OriginContains != "" {
+		where = append(where, "instr(original_url, ?) > 0")
+		args = append(args, q.OriginContains)
+	}
+
+	column := "url_id"
+	if q.Sort == store.SortByShort {
+		column = "short_url"
+	}
+
+	op, dir := ">", "ASC"
+	if q.Desc {
+		op, dir = "<", "DESC"
+	}
+
+	if q.After != nil {
+		where = append(where, column+" "+op+" ?")
+		if q.Sort == store.SortByShort {
+			args = append(args, q.After.URLShort)
+		} else {
+			args = append(args, q.After.ID)
+		}
+	}
+
+	query := "SELECT " + urlColumns + " FROM urls WHERE " +
+		strings.Join(where, " AND ") + " ORDER BY " + column + " " + dir
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	return r.list(ctx, query, args...)
+}
+
+func (r *URLRepository) list(ctx context.Context, query string, args ...interface{}) ([]*model.URL, error) {
+	var urls []*model.URL
+
+	rows, err := r.store.conn().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "query")
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan rows")
+		}
+
+		urls = append(urls, url)
+	}
+
+	return urls, rows.Err()
+}
+
+// UpdateUserID moves the url to the scope of the new owner as well with
+// store.DedupUser. A url of the same original url in that scope is looked
+// for first, in the same transaction, the driver only tells a unique
+// violation apart with cgo.
+func (r *URLRepository) UpdateUserID(ctx context.Context, url *model.URL, userID int) error {
+	query := "UPDATE urls SET user_id = ?1 WHERE url_id = ?2"
+	if r.store.Dedup == store.DedupUser {
+		query = "UPDATE urls SET user_id = ?1, dedup_user_id = ?1 WHERE url_id = ?2"
+	}
+
+	err := r.store.withTx(ctx, func(tx *Store) error {
+		if tx.Dedup == store.DedupUser {
+			var taken bool
+			if err := tx.conn().QueryRowContext(
+				ctx,
+				`SELECT EXISTS (SELECT 1 FROM urls WHERE dedup_user_id = ?1 AND url_id != ?2
+	AND original_url = (SELECT original_url FROM urls WHERE url_id = ?2))`,
+				userID,
+				url.ID,
+			).Scan(&taken); err != nil {
+				return err
+			}
+			if taken {
+				return store.ErrURLExist
+			}
+		}
+
+		res, err := tx.conn().ExecContext(ctx, query, userID, url.ID)
+		if err != nil {
+			return err
+		}
+
+		return expectRow(res)
+	})
+	if err != nil {
+		return err
+	}
+	url.UserID = userID
+
+	return nil
+}
+
+// expectRow turns an update which has not found its row into
+// store.ErrRecordNotFound.
+func expectRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrRecordNotFound
+	}
+
+	return nil
+}
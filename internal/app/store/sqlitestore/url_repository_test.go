@@ -0,0 +1,229 @@
+package sqlitestore_test
+
+import (
+	"context"
+	"errors"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/sqlitestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestURLRepository(t *testing.T) {
+	st := sqlitestore.TestStore(t)
+	ctx := context.Background()
+
+	url := model.TestURL(t)
+	user := model.TestUser(t)
+
+	require.NoError(t, st.URL().Create(ctx, url))
+	assert.NotZero(t, url.ID)
+
+	require.NoError(t, st.User().Create(ctx, user))
+	assert.NotZero(t, user.ID)
+
+	u, err := st.URL().FindByUUID(ctx, url.URLShort)
+	assert.NoError(t, err)
+	assert.Equal(t, url.URLOrigin, u.URLOrigin)
+
+	u2, err := st.URL().FindByID(ctx, url.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, u, u2)
+
+	assert.NoError(t, st.URL().UpdateUserID(ctx, url, user.ID))
+
+	urls, err := st.URL().FindByUserID(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1)
+	assert.Equal(t, user.ID, urls[0].UserID)
+
+	duplicate := &model.URL{URLOrigin: url.URLOrigin, URLShort: "other"}
+	assert.ErrorIs(t, st.URL().Create(ctx, duplicate), store.ErrURLExist)
+	assert.Equal(t, url.URLShort, duplicate.URLShort)
+	assert.Equal(t, url.ID, duplicate.ID)
+
+	_, err = st.URL().FindByUUID(ctx, "missing")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+}
+
+func TestURLRepositoryDelete(t *testing.T) {
+	st := sqlitestore.TestStore(t)
+	ctx := context.Background()
+
+	url := model.TestURLGenerated(t)
+	other := model.TestURLGenerated(t)
+
+	require.NoError(t, st.URL().Create(ctx, url))
+	require.NoError(t, st.URL().Create(ctx, other))
+	assert.NoError(t, st.URL().Delete(ctx, url))
+
+	u, err := st.URL().FindByUUID(ctx, url.URLShort)
+	assert.NoError(t, err)
+	assert.True(t, u.IsDeleted)
+	assert.True(t, st.URL().IsDeleted(ctx, url.ID))
+	assert.False(t, st.URL().IsDeleted(ctx, other.ID))
+
+	assert.NoError(t, st.URL().BatchDelete(ctx, []int{other.ID}))
+	assert.True(t, st.URL().IsDeleted(ctx, other.ID))
+}
+
+func TestStoreMigrations(t *testing.T) {
+	st := sqlitestore.TestStore(t)
+	ctx := context.Background()
+
+	version, dirty, err := st.MigrationVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint(5), version)
+	assert.False(t, dirty)
+
+	require.NoError(t, st.MigrateDown(ctx, 0))
+	version, _, err = st.MigrationVersion(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, version)
+
+	require.NoError(t, st.MigrateUp(ctx))
+	require.NoError(t, st.URL().Create(ctx, model.TestURLGenerated(t)))
+}
+
+func TestURLRepositoryBatchCreate(t *testing.T) {
+	st := sqlitestore.TestStore(t)
+	ctx := context.Background()
+
+	existing := model.TestURLGenerated(t)
+	assert.NoError(t, st.URL().Create(ctx, existing))
+
+	fresh := model.TestURLGenerated(t)
+	urls := []*model.URL{
+		fresh,
+		{URLOrigin: existing.URLOrigin, URLShort: "existing"},
+		{URLOrigin: fresh.URLOrigin, URLShort: "dup"},
+	}
+
+	created, err := st.URL().BatchCreate(ctx, urls)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false, false}, created)
+	assert.Equal(t, existing.URLShort, urls[1].URLShort)
+	assert.Equal(t, fresh.URLShort, urls[2].URLShort)
+	assert.Equal(t, fresh.ID, urls[2].ID)
+
+	u, err := st.URL().FindByUUID(ctx, fresh.URLShort)
+	assert.NoError(t, err)
+	assert.Equal(t, fresh.ID, u.ID)
+
+	invalid := model.TestURLGenerated(t)
+	_, err = st.URL().BatchCreate(ctx, []*model.URL{invalid, {URLOrigin: "http://wrong", URLShort: "wrong"}})
+	assert.Error(t, err)
+
+	_, err = st.URL().FindByUUID(ctx, invalid.URLShort)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+}
+
+func TestStoreWithTx(t *testing.T) {
+	st := sqlitestore.TestStore(t)
+	ctx := context.Background()
+
+	user := model.TestUser(t)
+	url := model.TestURLGenerated(t)
+
+	err := st.WithTx(ctx, func(tx store.Store) error {
+		if err := tx.User().Create(ctx, user); err != nil {
+			return err
+		}
+		if err := tx.URL().Create(ctx, url); err != nil {
+			return err
+		}
+
+		return tx.URL().UpdateUserID(ctx, url, user.ID)
+	})
+	assert.NoError(t, err)
+
+	u, err := st.URL().FindByUUID(ctx, url.URLShort)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, u.UserID)
+
+	errFailed := errors.New("failed")
+	other := model.TestURLGenerated(t)
+
+	err = st.WithTx(ctx, func(tx store.Store) error {
+		if err := tx.URL().Create(ctx, other); err != nil {
+			return err
+		}
+		if err := tx.URL().BatchDelete(ctx, []int{url.ID}); err != nil {
+			return err
+		}
+		if err := tx.URL().UpdateUserID(ctx, url, 0); err != nil {
+			return err
+		}
+
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+
+	_, err = st.URL().FindByUUID(ctx, other.URLShort)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	u, err = st.URL().FindByUUID(ctx, url.URLShort)
+	assert.NoError(t, err)
+	assert.False(t, u.IsDeleted)
+	assert.Equal(t, user.ID, u.UserID)
+
+	next := model.TestURLGenerated(t)
+	assert.NoError(t, st.URL().Create(ctx, next))
+	assert.Equal(t, url.ID+1, next.ID)
+}
+
+func TestURLRepositoryFindByUserIDPage(t *testing.T) {
+	st := sqlitestore.TestStore(t)
+	ctx := context.Background()
+
+	var urls []*model.URL
+	for i := 0; i < 5; i++ {
+		url := model.TestURLGenerated(t)
+		require.NoError(t, st.URL().Create(ctx, url))
+		require.NoError(t, st.URL().UpdateUserID(ctx, url, 1))
+		urls = append(urls, url)
+	}
+	require.NoError(t, st.URL().Create(ctx, model.TestURLGenerated(t)))
+	require.NoError(t, st.URL().BatchDelete(ctx, []int{urls[1].ID}))
+
+	ids := func(urls []*model.URL) []int {
+		var result []int
+		for _, url := range urls {
+			result = append(result, url.ID)
+		}
+		return result
+	}
+
+	page, err := st.URL().FindByUserIDPage(ctx, 1, store.URLQuery{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, ids(urls[:2]), ids(page))
+
+	page, err = st.URL().FindByUserIDPage(ctx, 1, store.URLQuery{Limit: 2, After: page[1]})
+	require.NoError(t, err)
+	assert.Equal(t, ids(urls[2:4]), ids(page))
+
+	page, err = st.URL().FindByUserIDPage(ctx, 1, store.URLQuery{Desc: true, After: urls[2]})
+	require.NoError(t, err)
+	assert.Equal(t, []int{urls[1].ID, urls[0].ID}, ids(page))
+
+	page, err = st.URL().FindByUserIDPage(ctx, 1, store.URLQuery{ExcludeDeleted: true})
+	require.NoError(t, err)
+	assert.Equal(t, []int{urls[0].ID, urls[2].ID, urls[3].ID, urls[4].ID}, ids(page))
+
+	page, err = st.URL().FindByUserIDPage(ctx, 1, store.URLQuery{OriginContains: urls[3].URLOrigin})
+	require.NoError(t, err)
+	assert.Equal(t, []int{urls[3].ID}, ids(page))
+
+	page, err = st.URL().FindByUserIDPage(ctx, 1, store.URLQuery{Sort: store.SortByShort})
+	require.NoError(t, err)
+	require.Len(t, page, len(urls))
+	for i := 1; i < len(page); i++ {
+		assert.Less(t, page[i-1].URLShort, page[i].URLShort)
+	}
+
+	page, err = st.URL().FindByUserIDPage(ctx, 1, store.URLQuery{Sort: store.SortByShort, After: page[2]})
+	require.NoError(t, err)
+	assert.Len(t, page, 2)
+}
@@ -0,0 +1,57 @@
+package sqlitestore
+
+import (
+	"context"
+	"database/sql"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+)
+
+type UserRepository struct {
+	store *Store
+}
+
+func (r *UserRepository) Create(ctx context.Context, user *model.User) error {
+	if _, err := r.store.conn().ExecContext(
+		ctx,
+		"INSERT INTO users (uuid) VALUES (?) ON CONFLICT (uuid) DO NOTHING",
+		user.UUID,
+	); err != nil {
+		return err
+	}
+
+	return r.store.conn().QueryRowContext(
+		ctx,
+		"SELECT user_id FROM users WHERE uuid = ?",
+		user.UUID,
+	).Scan(&user.ID)
+}
+
+func (r *UserRepository) FindByUUID(ctx context.Context, uuid string) (*model.User, error) {
+	return r.find(ctx, "uuid = ?", uuid)
+}
+
+func (r *UserRepository) FindByID(ctx context.Context, id int) (*model.User, error) {
+	return r.find(ctx, "user_id = ?", id)
+}
+
+func (r *UserRepository) find(ctx context.Context, where string, arg interface{}) (*model.User, error) {
+	u := &model.User{}
+
+	if err := r.store.conn().QueryRowContext(
+		ctx,
+		"SELECT user_id, uuid FROM users WHERE "+where,
+		arg,
+	).Scan(
+		&u.ID,
+		&u.UUID,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, store.ErrUserNotFound
+		}
+
+		return nil, err
+	}
+
+	return u, nil
+}
@@ -0,0 +1,72 @@
+package sqlitestore_test
+
+import (
+	"context"
+	"errors"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/sqlitestore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+func TestUserRepository(t *testing.T) {
+	st := sqlitestore.TestStore(t)
+
+	url := model.TestURL(t)
+	user := model.TestUser(t)
+
+	assert.Condition(t, func() bool {
+		err := st.URL().Create(context.Background(), url)
+		if errors.Is(err, store.ErrURLExist) {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+
+		return true
+	})
+
+	assert.NotNil(t, url.ID)
+
+	assert.NoError(t, st.User().Create(context.Background(), user))
+	assert.NotNil(t, user.ID)
+
+	u, err := st.URL().FindByUUID(context.Background(), url.URLShort)
+	assert.NoError(t, err)
+	assert.Equal(t, url.URLOrigin, u.URLOrigin)
+
+	u2, err := st.URL().FindByID(context.Background(), url.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, u, u2)
+
+	err = st.URL().UpdateUserID(context.Background(), url, user.ID)
+	assert.NoError(t, err)
+}
+
+func TestUserRepositoryCreateConcurrent(t *testing.T) {
+	st := sqlitestore.TestStore(t)
+	uuid := model.TestUser(t).UUID
+
+	users := make([]*model.User, 8)
+	errs := make([]error, len(users))
+	var wg sync.WaitGroup
+	for i := range users {
+		users[i] = &model.User{UUID: uuid}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = st.User().Create(context.Background(), users[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i, user := range users {
+		require.NoError(t, errs[i])
+		assert.Equal(t, users[0].ID, user.ID)
+	}
+	assert.NotZero(t, users[0].ID)
+}
@@ -0,0 +1,132 @@
+package sqlstore
+
+import (
+	"context"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/pkg/errors"
+)
+
+func (s *Store) ExportUsers(ctx context.Context, fn func(user *model.User) error) error {
+	rows, err := s.conn().QueryContext(ctx, "SELECT user_id, uuid FROM users ORDER BY user_id")
+	if err != nil {
+		return errors.Wrap(err, "query")
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var user model.User
+		if err := rows.Scan(&user.ID, &user.UUID); err != nil {
+			return errors.Wrap(err, "scan rows")
+		}
+		if err := fn(&user); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *Store) ExportURLs(ctx context.Context, fn func(url *model.URL) error) error {
+	rows, err := s.conn().QueryContext(ctx, "SELECT "+urlColumns+" FROM urls ORDER BY url_id")
+	if err != nil {
+		return errors.Wrap(err, "query")
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return errors.Wrap(err, "scan rows")
+		}
+		if err := fn(url); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ImportUsers upserts the batch in one transaction and moves the serial
+// past the largest ID.
+func (s *Store) ImportUsers(ctx context.Context, users []*model.User) error {
+	return s.withTx(ctx, func(tx *Store) error {
+		for _, user := range users {
+			if _, err := tx.conn().ExecContext(
+				ctx,
+				`INSERT INTO users (user_id, uuid) VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET uuid = EXCLUDED.uuid`,
+				user.ID,
+				user.UUID,
+			); err != nil {
+				return errors.Wrapf(err, "user %d", user.ID)
+			}
+		}
+
+		return tx.raiseSequence(ctx, "users", "user_id", 0)
+	})
+}
+
+// ImportURLs works like ImportUsers.
+func (s *Store) ImportURLs(ctx context.Context, urls []*model.URL) error {
+	return s.withTx(ctx, func(tx *Store) error {
+		for _, url := range urls {
+			if _, err := tx.conn().ExecContext(
+				ctx,
+				`INSERT INTO urls (url_id, user_id, original_url, short_url, is_deleted, expires_at, deleted_at, dedup_user_id, original_url_hash) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, md5($3))
+	ON CONFLICT (url_id) DO UPDATE SET
+		user_id = EXCLUDED.user_id,
+		original_url = EXCLUDED.original_url,
+		original_url_hash = EXCLUDED.original_url_hash,
+		short_url = EXCLUDED.short_url,
+		is_deleted = EXCLUDED.is_deleted,
+		expires_at = EXCLUDED.expires_at,
+		deleted_at = EXCLUDED.deleted_at,
+		dedup_user_id = EXCLUDED.dedup_user_id`,
+				url.ID,
+				url.UserID,
+				url.URLOrigin,
+				url.URLShort,
+				url.IsDeleted,
+				url.ExpiresAt,
+				url.DeletedAt,
+				tx.Dedup.Owner(url),
+			); err != nil {
+				return errors.Wrapf(err, "url %d", url.ID)
+			}
+		}
+
+		return tx.raiseSequence(ctx, "urls", "url_id", 0)
+	})
+}
+
+func (s *Store) LastURLID(ctx context.Context) (int, error) {
+	var id int
+	err := s.conn().QueryRowContext(ctx, "SELECT COALESCE("+lastValue("urls", "url_id")+", 0)").Scan(&id)
+
+	return id, err
+}
+
+func (s *Store) RaiseURLID(ctx context.Context, id int) error {
+	return s.raiseSequence(ctx, "urls", "url_id", id)
+}
+
+// raiseSequence moves the serial of the column up to the largest ID of the
+// table and id, it never goes back. The serial of an empty table is left
+// uncalled, the first record gets 1.
+func (s *Store) raiseSequence(ctx context.Context, table, column string, id int) error {
+	_, err := s.conn().ExecContext(
+		ctx,
+		`SELECT setval(pg_get_serial_sequence('`+table+`', '`+column+`'), COALESCE(v, 1), v IS NOT NULL)
+	FROM (SELECT GREATEST(MAX(`+column+`), `+lastValue(table, column)+`, NULLIF($1::int, 0)) AS v FROM `+table+`) m`,
+		id,
+	)
+
+	return err
+}
+
+// lastValue is the query of the last value handed out by the serial of the
+// column, NULL when there is none.
+func lastValue(table, column string) string {
+	return `(SELECT last_value FROM pg_sequences
+		WHERE format('%I.%I', schemaname, sequencename) = pg_get_serial_sequence('` + table + `', '` + column + `'))`
+}
@@ -0,0 +1,91 @@
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/iryzzh/practicum-go-shortener/db/migrations"
+)
+
+// withMigrate runs fn with a migrate instance bound to a dedicated connection
+// of the pool, the connection is released afterwards.
+func (s *Store) withMigrate(ctx context.Context, fn func(m *migrate.Migrate) error) error {
+	src, err := iofs.New(migrations.Postgres, "pg")
+	if err != nil {
+		return err
+	}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	m, err := migrate.NewWithInstance("iofs", src, "postgres", driver)
+	if err != nil {
+		driver.Close()
+		return err
+	}
+	defer m.Close()
+
+	return fn(m)
+}
+
+// MigrateUp applies all pending migrations.
+func (s *Store) MigrateUp(ctx context.Context) error {
+	return s.withMigrate(ctx, func(m *migrate.Migrate) error {
+		if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// MigrateDown rolls back the given number of migrations, all of them if
+// steps is not positive.
+func (s *Store) MigrateDown(ctx context.Context, steps int) error {
+	return s.withMigrate(ctx, func(m *migrate.Migrate) error {
+		var err error
+		if steps > 0 {
+			err = m.Steps(-steps)
+		} else {
+			err = m.Down()
+		}
+		if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// MigrationVersion returns the current schema version, zero when no
+// migration has been applied yet.
+func (s *Store) MigrationVersion(ctx context.Context) (version uint, dirty bool, err error) {
+	err = s.withMigrate(ctx, func(m *migrate.Migrate) error {
+		version, dirty, err = m.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			return nil
+		}
+
+		return err
+	})
+
+	return version, dirty, err
+}
+
+// MigrateForce sets the schema version without running migrations, it is
+// used to recover from a failed migration that left the schema dirty.
+func (s *Store) MigrateForce(ctx context.Context, version int) error {
+	return s.withMigrate(ctx, func(m *migrate.Migrate) error {
+		return m.Force(version)
+	})
+}
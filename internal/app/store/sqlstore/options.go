@@ -0,0 +1,23 @@
+package sqlstore
+
+import (
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+)
+
+type Option func(*Store)
+
+// WithAutoMigrate tells New whether to apply pending migrations, it does so
+// by default.
+func WithAutoMigrate(enabled bool) Option {
+	return func(s *Store) {
+		s.autoMigrate = enabled
+	}
+}
+
+// WithOptions sets the store.Options. The dedup scope is written along with
+// every url, changing it leaves the urls which are there in their scope.
+func WithOptions(o store.Options) Option {
+	return func(s *Store) {
+		s.Options = o
+	}
+}
@@ -1,56 +1,98 @@
 package sqlstore
 
 import (
+	"context"
 	"database/sql"
-	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
-	"log"
+	"github.com/pkg/errors"
 )
 
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 type Store struct {
-	db *sql.DB
+	db          *sql.DB
+	tx          *sql.Tx
+	autoMigrate bool
+	store.Options
 }
 
-func New(dsn string) (s *Store, err error) {
+func New(dsn string, opts ...Option) (*Store, error) {
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	s = &Store{
-		db: db,
+	s := &Store{
+		db:          db,
+		autoMigrate: true,
 	}
 
-	if err := s.migrate(); err != nil {
-		log.Fatal(err)
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Options.Init()
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	return s, db.Ping()
+	if s.autoMigrate {
+		if err := s.MigrateUp(context.Background()); err != nil {
+			db.Close()
+			return nil, errors.Wrap(err, "migrate")
+		}
+	}
+
+	return s, nil
 }
 
+// Close does nothing inside WithTx.
 func (s *Store) Close() error {
+	if s.tx != nil {
+		return nil
+	}
+
 	return s.db.Close()
 }
 
-func (s *Store) migrate() error {
-	driver, err := postgres.WithInstance(s.db, &postgres.Config{})
-	if err != nil {
-		return err
+// conn returns the running transaction, or the database outside of one.
+func (s *Store) conn() querier {
+	if s.tx != nil {
+		return s.tx
 	}
-	m, err := migrate.NewWithDatabaseInstance(
-		"file://db/migrations/pg",
-		"postgres", driver)
+
+	return s.db
+}
+
+func (s *Store) WithTx(ctx context.Context, fn func(tx store.Store) error) error {
+	return s.withTx(ctx, func(tx *Store) error {
+		return fn(tx)
+	})
+}
+
+// withTx joins the running transaction if there is one.
+func (s *Store) withTx(ctx context.Context, fn func(tx *Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+	if err := fn(&Store{db: s.db, tx: tx, Options: s.Options}); err != nil {
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 func (s *Store) URL() store.URLRepository {
@@ -61,6 +103,6 @@ func (s *Store) User() store.UserRepository {
 	return &UserRepository{store: s}
 }
 
-func (s *Store) Ping() error {
-	return s.db.Ping()
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
 }
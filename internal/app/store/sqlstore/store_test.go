@@ -0,0 +1,56 @@
+package sqlstore_test
+
+import (
+	"github.com/iryzzh/practicum-go-shortener/internal/app/shortcode"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/sqlstore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/storetest"
+	"os"
+	"testing"
+)
+
+// TestStore needs a PostgreSQL database whose contents may be dropped, it is
+// given with TEST_DATABASE_DSN.
+func TestStore(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	storetest.Run(t, func(t *testing.T) store.Store {
+		return sqlstore.TestStore(t, dsn)
+	})
+}
+
+func TestStoreDedupUser(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	storetest.RunDedupUser(t, func(t *testing.T) store.Store {
+		return sqlstore.TestStore(t, dsn, sqlstore.WithOptions(store.Options{Dedup: store.DedupUser}))
+	})
+}
+
+func TestStoreGenerator(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	storetest.RunGenerator(t, func(t *testing.T, gen shortcode.Generator) store.Store {
+		return sqlstore.TestStore(t, dsn, sqlstore.WithOptions(store.Options{Generator: gen}))
+	})
+}
+
+func TestStoreCaseInsensitive(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	storetest.RunCaseInsensitive(t, func(t *testing.T, gen shortcode.Generator) store.Store {
+		return sqlstore.TestStore(t, dsn, sqlstore.WithOptions(store.Options{Generator: gen, Case: store.CaseInsensitive}))
+	})
+}
@@ -1,31 +1,24 @@
 package sqlstore
 
-import (
-	"database/sql"
-	"fmt"
-	"strings"
-	"testing"
+import "testing"
 
-	_ "github.com/lib/pq"
-)
-
-func TestDB(t *testing.T, dsn string) (*sql.DB, func(...string)) {
+// TestStore connects to the database at dsn and empties it, the store is
+// closed when the test finishes.
+func TestStore(t *testing.T, dsn string, opts ...Option) *Store {
 	t.Helper()
 
-	db, err := sql.Open("postgres", dsn)
+	s, err := New(dsn, opts...)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if err := db.Ping(); err != nil {
+	t.Cleanup(func() {
+		s.Close()
+	})
+
+	if _, err := s.db.Exec("TRUNCATE urls, users RESTART IDENTITY"); err != nil {
 		t.Fatal(err)
 	}
 
-	return db, func(s ...string) {
-		if len(s) > 0 {
-			db.Exec(fmt.Sprintf("TRUNCATE %s CASCADE", strings.Join(s, ", ")))
-		}
-
-		db.Close()
-	}
+	return s
 }
@@ -1,21 +1,78 @@
 package sqlstore
 
 import (
+	"context"
 	"database/sql"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const (
+	urlColumns = "url_id, user_id, original_url, short_url, is_deleted, expires_at, deleted_at"
+
+	// the ID is taken from the sequence before, so a url whose original
+	// url or short code is there already is not inserted and the caller
+	// tells the two apart
+	insertURL = `INSERT INTO urls (url_id, user_id, original_url, short_url, expires_at, dedup_user_id, original_url_hash)
+	VALUES ($1, $2, $3, $4, $5, $6, md5($3))
+	ON CONFLICT DO NOTHING`
+)
+
+// scanner is implemented by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanURL(row scanner) (*model.URL, error) {
+	var (
+		url       model.URL
+		expiresAt sql.NullTime
+		deletedAt sql.NullTime
+	)
+
+	if err := row.Scan(&url.ID, &url.UserID, &url.URLOrigin, &url.URLShort, &url.IsDeleted, &expiresAt, &deletedAt); err != nil {
+		return nil, err
+	}
+	url.ExpiresAt = nullTime(expiresAt)
+	url.DeletedAt = nullTime(deletedAt)
+
+	return &url, nil
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	v := t.Time.UTC()
+
+	return &v
+}
+
+// prefixed reads a column in front of the ones of the scanner.
+type prefixed struct {
+	scanner
+	first interface{}
+}
+
+func (p prefixed) Scan(dest ...interface{}) error {
+	return p.scanner.Scan(append([]interface{}{p.first}, dest...)...)
+}
+
 type URLRepository struct {
 	store *Store
 }
 
-func (r *URLRepository) IsDeleted(id int) bool {
+func (r *URLRepository) IsDeleted(ctx context.Context, id int) bool {
 	u := &model.URL{}
 
-	err := r.store.db.QueryRow(
+	err := r.store.conn().QueryRowContext(
+		ctx,
 		"select url_id, is_deleted from urls where url_id = $1",
 		id,
 	).Scan(
@@ -29,62 +86,303 @@ func (r *URLRepository) IsDeleted(id int) bool {
 	return u.IsDeleted
 }
 
-func (r *URLRepository) BatchDelete(ids []int) error {
-	_, err := r.store.db.Exec(`UPDATE urls SET is_deleted = true WHERE url_id = ANY($1::int[]);`, pq.Array(ids))
+func (r *URLRepository) BatchDelete(ctx context.Context, ids []int) error {
+	_, err := r.store.conn().ExecContext(ctx, `UPDATE urls SET is_deleted = true, deleted_at = now() WHERE NOT is_deleted AND url_id = ANY($1::int[]);`, pq.Array(ids))
 
 	return err
 }
 
-func (r *URLRepository) Delete(url *model.URL) error {
-	_, err := r.store.db.Exec(`UPDATE urls SET is_deleted = true WHERE url_id = $1`, url.ID)
+func (r *URLRepository) DeleteExpired(ctx context.Context, now time.Time) ([]int, error) {
+	rows, err := r.store.conn().QueryContext(
+		ctx,
+		"UPDATE urls SET is_deleted = true, deleted_at = $1 WHERE NOT is_deleted AND expires_at <= $1 RETURNING url_id",
+		now,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "update")
+	}
+
+	return scanIDs(rows)
+}
+
+// Purge removes the rows which are deleted among ids.
+func (r *URLRepository) Purge(ctx context.Context, ids []int) error {
+	_, err := r.store.conn().ExecContext(ctx, `DELETE FROM urls WHERE is_deleted AND url_id = ANY($1::int[]);`, pq.Array(ids))
 
 	return err
 }
 
-func (r *URLRepository) Create(url *model.URL) error {
-	if err := url.Validate(); err != nil {
+func (r *URLRepository) PurgeDeleted(ctx context.Context, before time.Time) ([]int, error) {
+	rows, err := r.store.conn().QueryContext(
+		ctx,
+		"DELETE FROM urls WHERE is_deleted AND (deleted_at IS NULL OR deleted_at <= $1) RETURNING url_id",
+		before,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "delete")
+	}
+
+	return scanIDs(rows)
+}
+
+// scanIDs reads the url IDs returned by a statement and sorts them.
+func scanIDs(rows *sql.Rows) ([]int, error) {
+	defer func() { _ = rows.Close() }()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "scan rows")
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Ints(ids)
+
+	return ids, nil
+}
+
+func (r *URLRepository) Delete(ctx context.Context, url *model.URL) error {
+	res, err := r.store.conn().ExecContext(ctx, `UPDATE urls SET deleted_at = CASE WHEN is_deleted THEN deleted_at ELSE now() END, is_deleted = true WHERE url_id = $1`, url.ID)
+	if err != nil {
 		return err
 	}
 
-	shortURL := url.URLShort
-
-	err := r.store.db.QueryRow(
-		`WITH e AS (
-    INSERT INTO urls ("original_url", "short_url")
-        VALUES ($1, $2)
-        ON CONFLICT ("original_url") DO NOTHING
-        RETURNING "url_id", "short_url")
-	SELECT *
-	FROM e
-	UNION
-	SELECT "url_id", "short_url"
-	FROM urls
-	WHERE "original_url" = $1;`,
-		url.URLOrigin,
-		url.URLShort,
-	).Scan(&url.ID, &url.URLShort)
+	return expectRow(res)
+}
+
+func (r *URLRepository) Create(ctx context.Context, url *model.URL) error {
+	if err := url.Validate(r.store.MaxURLLength); err != nil {
+		return err
+	}
+	r.store.Case.FoldAll(url)
+
+	ids, err := r.nextIDs(ctx, 1)
 	if err != nil {
 		return err
 	}
 
-	if shortURL != url.URLShort {
+	v := *url
+	v.ID = ids[0]
+
+	err = store.Generate(r.store.Generator, &v, func() error {
+		res, err := r.store.conn().ExecContext(
+			ctx,
+			insertURL,
+			v.ID,
+			v.UserID,
+			v.URLOrigin,
+			v.URLShort,
+			v.ExpiresAt,
+			r.store.Dedup.Owner(&v),
+		)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return nil
+		}
+
+		existing, err := r.findByOrigin(ctx, &v)
+		if errors.Is(err, store.ErrRecordNotFound) {
+			return store.ErrShortExist
+		}
+		if err != nil {
+			return err
+		}
+		v = *existing
+
 		return store.ErrURLExist
+	})
+	if err == nil || errors.Is(err, store.ErrURLExist) {
+		*url = v
 	}
 
-	return nil
+	return err
 }
 
-func (r *URLRepository) FindByID(id int) (*model.URL, error) {
-	u := &model.URL{}
+// BatchCreate inserts the urls with a single statement inside a
+// transaction and then reads back the urls that already existed. The urls
+// whose codes turn out to be taken get new ones and are inserted again.
+func (r *URLRepository) BatchCreate(ctx context.Context, urls []*model.URL) ([]bool, error) {
+	for _, url := range urls {
+		if err := url.Validate(r.store.MaxURLLength); err != nil {
+			return nil, err
+		}
+	}
+	r.store.Case.FoldAll(urls...)
 
-	err := r.store.db.QueryRow(
-		"SELECT url_id, short_url, original_url FROM urls WHERE url_id = $1",
-		id,
-	).Scan(
-		&u.ID,
-		&u.URLShort,
-		&u.URLOrigin,
+	created := make([]bool, len(urls))
+	result := make([]model.URL, len(urls))
+
+	err := r.store.withTx(ctx, func(tx *Store) error {
+		repo := &URLRepository{store: tx}
+
+		// every url gets an ID up front, the ones which are there already
+		// leave gaps
+		ids, err := repo.nextIDs(ctx, len(urls))
+		if err != nil {
+			return err
+		}
+
+		pending := make([]int, len(urls))
+		for i, url := range urls {
+			result[i] = *url
+			result[i].ID = ids[i]
+			pending[i] = i
+		}
+
+		for attempt := 0; len(pending) > 0; attempt++ {
+			for _, i := range pending {
+				if urls[i].URLShort == "" {
+					result[i].URLShort = tx.Generator.Generate(result[i].ID, attempt)
+				}
+			}
+
+			batch := make([]*model.URL, len(pending))
+			for j, i := range pending {
+				batch[j] = &result[i]
+			}
+
+			inserted, stored, err := repo.insertBatch(ctx, batch)
+			if err != nil {
+				return err
+			}
+
+			var taken []int
+			for j, i := range pending {
+				switch {
+				case inserted[result[i].ID]:
+					created[i] = true
+				case stored[j] != nil:
+					result[i] = *stored[j]
+				case urls[i].URLShort != "" || attempt+1 == store.GenerateAttempts:
+					return store.ErrShortExist
+				default:
+					taken = append(taken, i)
+				}
+			}
+			pending = taken
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, url := range urls {
+		*url = result[i]
+	}
+
+	return created, nil
+}
+
+// insertBatch inserts the urls which are not there yet and returns their
+// IDs along with the urls stored for the original urls of the batch, by
+// position. A url which is neither inserted nor stored has a taken code.
+func (r *URLRepository) insertBatch(ctx context.Context, urls []*model.URL) (map[int]bool, []*model.URL, error) {
+	ids := make([]int, len(urls))
+	users := make([]int, len(urls))
+	owners := make([]int, len(urls))
+	origins := make([]string, len(urls))
+	shorts := make([]string, len(urls))
+	// a timestamp array element is passed as text, nil stays NULL
+	expires := make([]*string, len(urls))
+	for i, url := range urls {
+		ids[i] = url.ID
+		users[i] = url.UserID
+		owners[i] = r.store.Dedup.Owner(url)
+		origins[i] = url.URLOrigin
+		shorts[i] = url.URLShort
+		if url.ExpiresAt != nil {
+			v := url.ExpiresAt.Format(time.RFC3339Nano)
+			expires[i] = &v
+		}
+	}
+
+	rows, err := r.store.conn().QueryContext(
+		ctx,
+		`INSERT INTO urls ("url_id", "user_id", "original_url", "short_url", "expires_at", "dedup_user_id", "original_url_hash")
+	SELECT *, md5(b.origin) FROM unnest($1::int[], $2::int[], $3::text[], $4::text[], $5::timestamptz[], $6::int[]) AS b(url_id, user_id, origin, short, expires_at, owner_id)
+	ON CONFLICT DO NOTHING
+	RETURNING "url_id";`,
+		pq.Array(ids),
+		pq.Array(users),
+		pq.Array(origins),
+		pq.Array(shorts),
+		pq.Array(expires),
+		pq.Array(owners),
+	)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "insert")
+	}
+	insertedIDs, err := scanIDs(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inserted := make(map[int]bool)
+	for _, id := range insertedIDs {
+		inserted[id] = true
+	}
+
+	// every url of the batch is matched with the stored one by its position
+	rows, err = r.store.conn().QueryContext(
+		ctx,
+		`SELECT b.ord, `+urlColumns+`
+	FROM unnest($1::int[], $2::text[]) WITH ORDINALITY AS b(owner_id, origin, ord)
+	JOIN urls ON urls.dedup_user_id = b.owner_id AND urls.original_url_hash = md5(b.origin) AND urls.original_url = b.origin`,
+		pq.Array(owners),
+		pq.Array(origins),
+	)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "query")
+	}
+	defer func() { _ = rows.Close() }()
+
+	stored := make([]*model.URL, len(urls))
+	for rows.Next() {
+		var ord int
+		url, err := scanURL(prefixed{rows, &ord})
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "scan rows")
+		}
+		stored[ord-1] = url
+	}
+
+	return inserted, stored, rows.Err()
+}
+
+// nextIDs takes n url IDs from the sequence.
+func (r *URLRepository) nextIDs(ctx context.Context, n int) ([]int, error) {
+	rows, err := r.store.conn().QueryContext(
+		ctx,
+		"SELECT nextval(pg_get_serial_sequence('urls', 'url_id')) FROM generate_series(1, $1)",
+		n,
 	)
+	if err != nil {
+		return nil, errors.Wrap(err, "next id")
+	}
+
+	return scanIDs(rows)
+}
+
+func (r *URLRepository) findByOrigin(ctx context.Context, url *model.URL) (*model.URL, error) {
+	u, err := scanURL(r.store.conn().QueryRowContext(
+		ctx,
+		"SELECT "+urlColumns+" FROM urls WHERE dedup_user_id = $1 AND original_url_hash = md5($2) AND original_url = $2",
+		r.store.Dedup.Owner(url),
+		url.URLOrigin,
+	))
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, store.ErrRecordNotFound
 	}
@@ -95,19 +393,34 @@ func (r *URLRepository) FindByID(id int) (*model.URL, error) {
 	return u, nil
 }
 
-func (r *URLRepository) FindByUUID(uuid string) (*model.URL, error) {
-	u := &model.URL{}
+func (r *URLRepository) FindByID(ctx context.Context, id int) (*model.URL, error) {
+	u, err := scanURL(r.store.conn().QueryRowContext(
+		ctx,
+		"SELECT "+urlColumns+" FROM urls WHERE url_id = $1",
+		id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrRecordNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	err := r.store.db.QueryRow(
-		"SELECT url_id, user_id, original_url, short_url, is_deleted FROM urls WHERE short_url = $1",
+	return u, nil
+}
+
+func (r *URLRepository) FindByUUID(ctx context.Context, uuid string) (*model.URL, error) {
+	return r.store.Case.Find(uuid, func(short string) (*model.URL, error) {
+		return r.findByUUID(ctx, short)
+	})
+}
+
+func (r *URLRepository) findByUUID(ctx context.Context, uuid string) (*model.URL, error) {
+	u, err := scanURL(r.store.conn().QueryRowContext(
+		ctx,
+		"SELECT "+urlColumns+" FROM urls WHERE short_url = $1",
 		uuid,
-	).Scan(
-		&u.ID,
-		&u.UserID,
-		&u.URLOrigin,
-		&u.URLShort,
-		&u.IsDeleted,
-	)
+	))
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, store.ErrRecordNotFound
 	}
@@ -118,38 +431,116 @@ func (r *URLRepository) FindByUUID(uuid string) (*model.URL, error) {
 	return u, nil
 }
 
-func (r *URLRepository) FindByUserID(id int) ([]*model.URL, error) {
+func (r *URLRepository) FindByUserID(ctx context.Context, id int) ([]*model.URL, error) {
+	return r.list(ctx, "SELECT "+urlColumns+" FROM urls WHERE user_id = $1 ORDER BY url_id", id)
+}
+
+// FindByUserIDPage compares short codes bytewise, as the stores which keep
+// the urls in memory do, whatever the collation of the database is.
+func (r *URLRepository) FindByUserIDPage(ctx context.Context, id int, q store.URLQuery) ([]*model.URL, error) {
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	where := []string{"user_id = " + arg(id)}
+
+	if q.ExcludeDeleted {
+		where = append(where, "NOT is_deleted")
+	}
+	if q.OriginContains != "" {
+		where = append(where, "strpos(original_url, "+arg(q.OriginContains)+") > 0")
+	}
+
+	column := "url_id"
+	if q.Sort == store.SortByShort {
+		column = `short_url COLLATE "C"`
+	}
+
+	op, dir := ">", "ASC"
+	if q.Desc {
+		op, dir = "<", "DESC"
+	}
+
+	if q.After != nil {
+		if q.Sort == store.SortByShort {
+			where = append(where, column+" "+op+" "+arg(q.After.URLShort))
+		} else {
+			where = append(where, column+" "+op+" "+arg(q.After.ID))
+		}
+	}
+
+	query := "SELECT " + urlColumns + " FROM urls WHERE " +
+		strings.Join(where, " AND ") + " ORDER BY " + column + " " + dir
+	if q.Limit > 0 {
+		query += " LIMIT " + arg(q.Limit)
+	}
+
+	return r.list(ctx, query, args...)
+}
+
+func (r *URLRepository) list(ctx context.Context, query string, args ...interface{}) ([]*model.URL, error) {
 	var urls []*model.URL
 
-	rows, err := r.store.db.Query(
-		"SELECT url_id, user_id, original_url, short_url, is_deleted from urls where user_id = $1",
-		id)
+	rows, err := r.store.conn().QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, errors.Wrap(err, "query")
 	}
 	defer func() { _ = rows.Close() }()
 
 	for rows.Next() {
-		var url model.URL
-		if err := rows.Scan(&url.ID, &url.UserID, &url.URLOrigin, &url.URLShort, &url.IsDeleted); err != nil {
+		url, err := scanURL(rows)
+		if err != nil {
 			return nil, errors.Wrap(err, "scan rows")
 		}
 
-		urls = append(urls, &url)
+		urls = append(urls, url)
 	}
 
 	return urls, rows.Err()
 }
 
-func (r *URLRepository) UpdateUserID(url *model.URL, userID int) error {
+// UpdateUserID moves the url to the scope of the new owner as well with
+// store.DedupUser.
+func (r *URLRepository) UpdateUserID(ctx context.Context, url *model.URL, userID int) error {
+	query := "UPDATE urls SET user_id = $1 WHERE url_id = $2"
+	if r.store.Dedup == store.DedupUser {
+		query = "UPDATE urls SET user_id = $1, dedup_user_id = $1 WHERE url_id = $2"
+	}
+
+	res, err := r.store.conn().ExecContext(ctx, query, userID, url.ID)
+	if isUniqueViolation(err) {
+		return store.ErrURLExist
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := expectRow(res); err != nil {
+		return err
+	}
 	url.UserID = userID
 
-	if _, err := r.store.db.Exec(
-		"UPDATE urls SET user_id = $1 WHERE url_id = $2",
-		userID,
-		url.ID); err != nil {
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var e *pq.Error
+
+	return errors.As(err, &e) && e.Code == "23505"
+}
+
+// expectRow turns an update which has not found its row into
+// store.ErrRecordNotFound.
+func expectRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
 		return err
 	}
+	if n == 0 {
+		return store.ErrRecordNotFound
+	}
 
 	return nil
 }
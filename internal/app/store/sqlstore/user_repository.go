@@ -1,6 +1,7 @@
 package sqlstore
 
 import (
+	"context"
 	"database/sql"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
 	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
@@ -10,19 +11,21 @@ type UserRepository struct {
 	store *Store
 }
 
-func (r *UserRepository) Create(user *model.User) error {
-	if u, _ := r.FindByUUID(user.UUID); u != nil {
-		return nil
-	}
-
-	return r.store.db.QueryRow(
-		"INSERT INTO users (uuid) VALUES ($1) RETURNING user_id",
+// Create is a single statement, so that two first requests of the same uuid
+// get the same ID. The no-op update makes RETURNING see the existing row.
+func (r *UserRepository) Create(ctx context.Context, user *model.User) error {
+	return r.store.conn().QueryRowContext(
+		ctx,
+		`INSERT INTO users (uuid) VALUES ($1)
+	ON CONFLICT (uuid) DO UPDATE SET uuid = EXCLUDED.uuid
+	RETURNING user_id`,
 		user.UUID,
 	).Scan(&user.ID)
 }
 
-func (r *UserRepository) SaveURL(user *model.User, url *model.URL) error {
-	if _, err := r.store.db.Exec(
+func (r *UserRepository) SaveURL(ctx context.Context, user *model.User, url *model.URL) error {
+	if _, err := r.store.conn().ExecContext(
+		ctx,
 		"UPDATE urls SET user_id = $1 WHERE url_id = $2",
 		user.ID,
 		url.ID,
@@ -33,10 +36,11 @@ func (r *UserRepository) SaveURL(user *model.User, url *model.URL) error {
 	return nil
 }
 
-func (r *UserRepository) FindByUUID(uuid string) (*model.User, error) {
+func (r *UserRepository) FindByUUID(ctx context.Context, uuid string) (*model.User, error) {
 	u := &model.User{}
 
-	if err := r.store.db.QueryRow(
+	if err := r.store.conn().QueryRowContext(
+		ctx,
 		"SELECT user_id, uuid FROM users WHERE uuid = $1",
 		uuid,
 	).Scan(
@@ -44,7 +48,7 @@ func (r *UserRepository) FindByUUID(uuid string) (*model.User, error) {
 		&u.UUID,
 	); err != nil {
 		if err == sql.ErrNoRows {
-			return nil, store.ErrRecordNotFound
+			return nil, store.ErrUserNotFound
 		}
 
 		return nil, err
@@ -53,10 +57,11 @@ func (r *UserRepository) FindByUUID(uuid string) (*model.User, error) {
 	return u, nil
 }
 
-func (r *UserRepository) FindByID(id int) (*model.User, error) {
+func (r *UserRepository) FindByID(ctx context.Context, id int) (*model.User, error) {
 	u := &model.User{}
 
-	if err := r.store.db.QueryRow(
+	if err := r.store.conn().QueryRowContext(
+		ctx,
 		"SELECT user_id, uuid FROM users WHERE user_id = $1",
 		id,
 	).Scan(
@@ -64,7 +69,7 @@ func (r *UserRepository) FindByID(id int) (*model.User, error) {
 		&u.UUID,
 	); err != nil {
 		if err == sql.ErrNoRows {
-			return nil, store.ErrRecordNotFound
+			return nil, store.ErrUserNotFound
 		}
 
 		return nil, err
@@ -1,8 +1,13 @@
 package store
 
+import "context"
+
 type Store interface {
 	URL() URLRepository
 	User() UserRepository
-	Ping() error
+	// WithTx runs fn as a single unit of work: everything done through the
+	// store passed to fn is kept if fn returns nil and undone otherwise.
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+	Ping(ctx context.Context) error
 	Close() error
 }
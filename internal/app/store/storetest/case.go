@@ -0,0 +1,87 @@
+package storetest
+
+import (
+	"context"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/shortcode"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+// RunCaseInsensitive checks stores made with store.CaseInsensitive and the
+// given generator.
+func RunCaseInsensitive(t *testing.T, newStore func(t *testing.T, gen shortcode.Generator) store.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, newStore func(t *testing.T, gen shortcode.Generator) store.Store)
+	}{
+		{"Generate", testCaseGenerate},
+		{"Alias", testCaseAlias},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore)
+		})
+	}
+}
+
+// upperGenerator makes upper case codes of the ID.
+type upperGenerator struct{}
+
+func (upperGenerator) Generate(id, attempt int) string {
+	return shortcode.NewSequential(4, "ABCDEFGHIJ").Generate(id, attempt)
+}
+
+func testCaseGenerate(t *testing.T, newStore func(t *testing.T, gen shortcode.Generator) store.Store) {
+	ctx := context.Background()
+	st := newStore(t, upperGenerator{})
+
+	urls := newURLs(t, 3)
+	require.NoError(t, st.URL().Create(ctx, urls[0]))
+	_, err := st.URL().BatchCreate(ctx, urls[1:])
+	require.NoError(t, err)
+
+	for _, url := range urls {
+		// the codes are stored in lower case and found in any
+		assert.Equal(t, strings.ToLower(upperGenerator{}.Generate(url.ID, 0)), url.URLShort)
+		for _, short := range []string{url.URLShort, strings.ToUpper(url.URLShort)} {
+			u, err := st.URL().FindByUUID(ctx, short)
+			require.NoError(t, err, short)
+			assert.Equal(t, url.ID, u.ID)
+		}
+	}
+}
+
+func testCaseAlias(t *testing.T, newStore func(t *testing.T, gen shortcode.Generator) store.Store) {
+	ctx := context.Background()
+	st := newStore(t, shortcode.NewRandom(shortcode.DefaultLength, shortcode.Lowercase))
+
+	url := model.TestURLGenerated(t)
+	url.URLShort = "MyAlias"
+	require.NoError(t, st.URL().Create(ctx, url))
+	assert.Equal(t, "myalias", url.URLShort)
+
+	for _, short := range []string{"myalias", "MYALIAS", "MyAlias"} {
+		u, err := st.URL().FindByUUID(ctx, short)
+		require.NoError(t, err, short)
+		assert.Equal(t, url.ID, u.ID)
+	}
+
+	// an alias differing in case only is taken
+	dup := model.TestURLGenerated(t)
+	dup.URLShort = "MYALIAS"
+	assert.ErrorIs(t, st.URL().Create(ctx, dup), store.ErrShortExist)
+
+	batch := []*model.URL{model.TestURLGenerated(t), model.TestURLGenerated(t)}
+	batch[0].URLShort = "Other"
+	batch[1].URLShort = "OTHER"
+	_, err := st.URL().BatchCreate(ctx, batch)
+	assert.ErrorIs(t, err, store.ErrShortExist)
+
+	_, err = st.URL().FindByUUID(ctx, "unknown")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+}
@@ -0,0 +1,73 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+func testConcurrency(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	workers := 16
+
+	urls := make([]*model.URL, workers)
+	for i := range urls {
+		urls[i] = model.TestURLGenerated(t)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, workers)
+	for i := range urls {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = st.URL().Create(ctx, urls[i])
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[int]bool)
+	for i, url := range urls {
+		require.NoError(t, errs[i])
+		assert.False(t, seen[url.ID], "id %d is used twice", url.ID)
+		seen[url.ID] = true
+
+		u, err := st.URL().FindByUUID(ctx, url.URLShort)
+		require.NoError(t, err)
+		assert.Equal(t, url.ID, u.ID)
+	}
+
+	// the same original URL created at once is stored exactly once
+	origin := model.TestURLGenerated(t).URLOrigin
+	same := make([]*model.URL, workers)
+	for i := range same {
+		same[i] = &model.URL{URLOrigin: origin, URLShort: model.TestURLGenerated(t).URLShort}
+	}
+
+	for i := range same {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = st.URL().Create(ctx, same[i])
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for i, url := range same {
+		switch {
+		case errs[i] == nil:
+			created++
+		case !errors.Is(errs[i], store.ErrURLExist):
+			t.Fatal(errs[i])
+		}
+		assert.Equal(t, same[0].ID, url.ID)
+		assert.Equal(t, same[0].URLShort, url.URLShort)
+	}
+	assert.Equal(t, 1, created)
+}
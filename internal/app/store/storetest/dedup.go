@@ -0,0 +1,134 @@
+package storetest
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// RunDedupUser runs the part of the suite which depends on the dedup scope
+// against stores made with store.DedupUser.
+func RunDedupUser(t *testing.T, newStore func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, st store.Store)
+	}{
+		{"Create", testDedupUserCreate},
+		{"BatchCreate", testDedupUserBatchCreate},
+		{"UpdateUserID", testDedupUserUpdateUserID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func newUsers(t *testing.T, st store.Store, n int) []*model.User {
+	users := make([]*model.User, n)
+	for i := range users {
+		users[i] = &model.User{UUID: uuid.New().String()}
+		require.NoError(t, st.User().Create(context.Background(), users[i]))
+	}
+
+	return users
+}
+
+func testDedupUserCreate(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	users := newUsers(t, st, 2)
+	origin := model.TestURLGenerated(t).URLOrigin
+
+	urls := make([]*model.URL, 3)
+	for i, userID := range []int{users[0].ID, users[1].ID, 0} {
+		urls[i] = model.TestURLGenerated(t)
+		urls[i].URLOrigin = origin
+		urls[i].UserID = userID
+		require.NoError(t, st.URL().Create(ctx, urls[i]))
+	}
+	assert.NotEqual(t, urls[0].ID, urls[1].ID)
+	assert.NotEqual(t, urls[1].ID, urls[2].ID)
+
+	again := model.TestURLGenerated(t)
+	again.URLOrigin = origin
+	again.UserID = users[1].ID
+	require.ErrorIs(t, st.URL().Create(ctx, again), store.ErrURLExist)
+	assert.Equal(t, urls[1].ID, again.ID)
+	assert.Equal(t, urls[1].URLShort, again.URLShort)
+
+	for i, user := range users {
+		owned, err := st.URL().FindByUserID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []int{urls[i].ID}, ids(owned))
+	}
+}
+
+func testDedupUserBatchCreate(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	users := newUsers(t, st, 2)
+
+	existing := model.TestURLGenerated(t)
+	existing.UserID = users[0].ID
+	require.NoError(t, st.URL().Create(ctx, existing))
+
+	batch := make([]*model.URL, 4)
+	for i, userID := range []int{users[0].ID, users[1].ID, users[1].ID, 0} {
+		batch[i] = model.TestURLGenerated(t)
+		batch[i].URLOrigin = existing.URLOrigin
+		batch[i].UserID = userID
+	}
+
+	created, err := st.URL().BatchCreate(ctx, batch)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{false, true, false, true}, created)
+
+	assert.Equal(t, existing.ID, batch[0].ID)
+	assert.Equal(t, batch[1].ID, batch[2].ID)
+	assert.Equal(t, batch[1].URLShort, batch[2].URLShort)
+	assert.NotEqual(t, batch[1].ID, batch[3].ID)
+
+	owned, err := st.URL().FindByUserID(ctx, users[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int{batch[1].ID}, ids(owned))
+}
+
+func testDedupUserUpdateUserID(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	users := newUsers(t, st, 3)
+	origin := model.TestURLGenerated(t).URLOrigin
+
+	urls := make([]*model.URL, 2)
+	for i := range urls {
+		urls[i] = model.TestURLGenerated(t)
+		urls[i].URLOrigin = origin
+		urls[i].UserID = users[i].ID
+		require.NoError(t, st.URL().Create(ctx, urls[i]))
+	}
+
+	// the first user has the original url already
+	v := *urls[1]
+	assert.ErrorIs(t, st.URL().UpdateUserID(ctx, &v, users[0].ID), store.ErrURLExist)
+	u, err := st.URL().FindByID(ctx, urls[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, users[1].ID, u.UserID)
+
+	// the url moves to the scope of the third user
+	require.NoError(t, st.URL().UpdateUserID(ctx, &v, users[2].ID))
+
+	third := model.TestURLGenerated(t)
+	third.URLOrigin = origin
+	third.UserID = users[2].ID
+	require.ErrorIs(t, st.URL().Create(ctx, third), store.ErrURLExist)
+	assert.Equal(t, urls[1].ID, third.ID)
+
+	second := model.TestURLGenerated(t)
+	second.URLOrigin = origin
+	second.UserID = users[1].ID
+	require.NoError(t, st.URL().Create(ctx, second))
+	assert.NotEqual(t, urls[1].ID, second.ID)
+}
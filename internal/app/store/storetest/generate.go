@@ -0,0 +1,131 @@
+package storetest
+
+import (
+	"context"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/shortcode"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+)
+
+// collidingGenerator makes the same code for every url on the first
+// attempt and one of the ID on the next, or the same code forever when it is
+// stuck.
+type collidingGenerator struct {
+	stuck bool
+}
+
+func (g collidingGenerator) Generate(id, attempt int) string {
+	if attempt == 0 || g.stuck {
+		return "taken"
+	}
+
+	return "code-" + strconv.Itoa(id) + "-" + strconv.Itoa(attempt)
+}
+
+// RunGenerator checks how a store made with the given generator gives codes
+// to the urls created without one.
+func RunGenerator(t *testing.T, newStore func(t *testing.T, gen shortcode.Generator) store.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, newStore func(t *testing.T, gen shortcode.Generator) store.Store)
+	}{
+		{"Sequential", testGenerateSequential},
+		{"Retry", testGenerateRetry},
+		{"Exhausted", testGenerateExhausted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore)
+		})
+	}
+}
+
+func newURLs(t *testing.T, n int) []*model.URL {
+	urls := make([]*model.URL, n)
+	for i := range urls {
+		urls[i] = model.TestURLGenerated(t)
+		urls[i].URLShort = ""
+	}
+
+	return urls
+}
+
+func testGenerateSequential(t *testing.T, newStore func(t *testing.T, gen shortcode.Generator) store.Store) {
+	ctx := context.Background()
+	gen := shortcode.NewSequential(4, shortcode.Base62)
+	st := newStore(t, gen)
+
+	urls := newURLs(t, 3)
+	require.NoError(t, st.URL().Create(ctx, urls[0]))
+	_, err := st.URL().BatchCreate(ctx, urls[1:])
+	require.NoError(t, err)
+
+	for _, url := range urls {
+		assert.Equal(t, gen.Generate(url.ID, 0), url.URLShort)
+
+		u, err := st.URL().FindByUUID(ctx, url.URLShort)
+		require.NoError(t, err)
+		assert.Equal(t, url.ID, u.ID)
+	}
+
+	// a code the url comes with is kept
+	alias := model.TestURLGenerated(t)
+	alias.URLShort = "alias"
+	require.NoError(t, st.URL().Create(ctx, alias))
+	assert.Equal(t, "alias", alias.URLShort)
+
+	// and one which is there already is not replaced
+	dup := model.TestURLGenerated(t)
+	dup.URLShort = urls[0].URLShort
+	assert.ErrorIs(t, st.URL().Create(ctx, dup), store.ErrShortExist)
+}
+
+func testGenerateRetry(t *testing.T, newStore func(t *testing.T, gen shortcode.Generator) store.Store) {
+	ctx := context.Background()
+	st := newStore(t, collidingGenerator{})
+
+	urls := newURLs(t, 4)
+	require.NoError(t, st.URL().Create(ctx, urls[0]))
+	assert.Equal(t, "taken", urls[0].URLShort)
+
+	require.NoError(t, st.URL().Create(ctx, urls[1]))
+	assert.Equal(t, "code-"+strconv.Itoa(urls[1].ID)+"-1", urls[1].URLShort)
+
+	// the urls of a batch collide with the stored one and with each other
+	created, err := st.URL().BatchCreate(ctx, urls[2:])
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true}, created)
+	assert.NotEqual(t, urls[2].URLShort, urls[3].URLShort)
+
+	for _, url := range urls {
+		u, err := st.URL().FindByUUID(ctx, url.URLShort)
+		require.NoError(t, err)
+		assert.Equal(t, url.URLOrigin, u.URLOrigin)
+	}
+
+	// an existing original url is found before any code is made
+	dup := &model.URL{URLOrigin: urls[1].URLOrigin}
+	assert.ErrorIs(t, st.URL().Create(ctx, dup), store.ErrURLExist)
+	assert.Equal(t, urls[1].URLShort, dup.URLShort)
+}
+
+func testGenerateExhausted(t *testing.T, newStore func(t *testing.T, gen shortcode.Generator) store.Store) {
+	ctx := context.Background()
+	st := newStore(t, collidingGenerator{stuck: true})
+
+	urls := newURLs(t, 3)
+	require.NoError(t, st.URL().Create(ctx, urls[0]))
+
+	assert.ErrorIs(t, st.URL().Create(ctx, urls[1]), store.ErrShortExist)
+	_, err := st.URL().BatchCreate(ctx, urls[1:])
+	assert.ErrorIs(t, err, store.ErrShortExist)
+
+	owned, err := st.URL().FindByUserID(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []int{urls[0].ID}, ids(owned))
+}
@@ -0,0 +1,49 @@
+// Package storetest is the behavioural test suite every store.Store
+// implementation has to pass.
+package storetest
+
+import (
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"testing"
+)
+
+// Run runs the suite against the stores made by newStore. Every call of
+// newStore must return a new empty store; closing it is up to newStore,
+// e.g. with t.Cleanup.
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, st store.Store)
+	}{
+		{"URLCreate", testURLCreate},
+		{"URLCreateDuplicate", testURLCreateDuplicate},
+		{"URLCreateLong", testURLCreateLong},
+		{"URLCreateShortTaken", testURLCreateShortTaken},
+		{"URLBatchCreate", testURLBatchCreate},
+		{"URLOwnership", testURLOwnership},
+		{"URLPage", testURLPage},
+		{"URLDelete", testURLDelete},
+		{"URLBatchDelete", testURLBatchDelete},
+		{"URLExpiry", testURLExpiry},
+		{"URLPurge", testURLPurge},
+		{"User", testUser},
+		{"WithTx", testWithTx},
+		{"Concurrency", testConcurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func ids(urls []*model.URL) []int {
+	result := make([]int, 0, len(urls))
+	for _, url := range urls {
+		result = append(result, url.ID)
+	}
+
+	return result
+}
@@ -0,0 +1,80 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func testWithTx(t *testing.T, st store.Store) {
+	ctx := context.Background()
+
+	user := &model.User{UUID: uuid.New().String()}
+	url := model.TestURLGenerated(t)
+
+	err := st.WithTx(ctx, func(tx store.Store) error {
+		if err := tx.User().Create(ctx, user); err != nil {
+			return err
+		}
+		if err := tx.URL().Create(ctx, url); err != nil {
+			return err
+		}
+
+		return tx.URL().UpdateUserID(ctx, url, user.ID)
+	})
+	require.NoError(t, err)
+
+	u, err := st.URL().FindByUUID(ctx, url.URLShort)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, u.UserID)
+
+	errFailed := errors.New("failed")
+	other := model.TestURLGenerated(t)
+	otherUser := &model.User{UUID: uuid.New().String()}
+
+	err = st.WithTx(ctx, func(tx store.Store) error {
+		if err := tx.User().Create(ctx, otherUser); err != nil {
+			return err
+		}
+		if err := tx.URL().Create(ctx, other); err != nil {
+			return err
+		}
+
+		// the transaction sees its own changes
+		if _, err := tx.URL().FindByUUID(ctx, other.URLShort); err != nil {
+			return err
+		}
+
+		if err := tx.URL().BatchDelete(ctx, []int{url.ID}); err != nil {
+			return err
+		}
+		if err := tx.URL().UpdateUserID(ctx, url, otherUser.ID); err != nil {
+			return err
+		}
+
+		return errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+
+	_, err = st.URL().FindByUUID(ctx, other.URLShort)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	_, err = st.User().FindByUUID(ctx, otherUser.UUID)
+	assert.ErrorIs(t, err, store.ErrUserNotFound)
+
+	u, err = st.URL().FindByUUID(ctx, url.URLShort)
+	require.NoError(t, err)
+	assert.False(t, u.IsDeleted)
+	assert.Equal(t, user.ID, u.UserID)
+
+	next := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(ctx, next))
+	u, err = st.URL().FindByID(ctx, next.ID)
+	require.NoError(t, err)
+	assert.Equal(t, next.URLShort, u.URLShort)
+}
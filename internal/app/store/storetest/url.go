@@ -0,0 +1,444 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testURLCreate(t *testing.T, st store.Store) {
+	ctx := context.Background()
+
+	url := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(ctx, url))
+	assert.NotZero(t, url.ID)
+
+	want := model.URL{
+		ID:        url.ID,
+		URLOrigin: url.URLOrigin,
+		URLShort:  url.URLShort,
+	}
+
+	u, err := st.URL().FindByID(ctx, url.ID)
+	require.NoError(t, err)
+	assert.Equal(t, want, *u)
+
+	u, err = st.URL().FindByUUID(ctx, url.URLShort)
+	require.NoError(t, err)
+	assert.Equal(t, want, *u)
+
+	_, err = st.URL().FindByID(ctx, url.ID+1)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	_, err = st.URL().FindByUUID(ctx, "unknown")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	assert.Error(t, st.URL().Create(ctx, &model.URL{URLOrigin: "http://wrong", URLShort: "wrong"}))
+
+	next := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(ctx, next))
+	assert.Greater(t, next.ID, url.ID)
+}
+
+// testURLCreateLong checks urls well past the 255 characters the first
+// schema allowed, as tracking links often are.
+func testURLCreateLong(t *testing.T, st store.Store) {
+	ctx := context.Background()
+
+	url := model.TestURLGenerated(t)
+	url.URLOrigin += "?utm=" + strings.Repeat("x", 1000)
+	require.NoError(t, st.URL().Create(ctx, url))
+
+	u, err := st.URL().FindByUUID(ctx, url.URLShort)
+	require.NoError(t, err)
+	assert.Equal(t, url.URLOrigin, u.URLOrigin)
+
+	// urls which differ only past the first 255 characters are different
+	other := model.TestURLGenerated(t)
+	other.URLOrigin = url.URLOrigin + "y"
+	require.NoError(t, st.URL().Create(ctx, other))
+	assert.NotEqual(t, url.ID, other.ID)
+
+	dup := &model.URL{URLOrigin: url.URLOrigin, URLShort: "duplicate"}
+	assert.ErrorIs(t, st.URL().Create(ctx, dup), store.ErrURLExist)
+	assert.Equal(t, url.ID, dup.ID)
+
+	batch := []*model.URL{
+		{URLOrigin: url.URLOrigin, URLShort: "batch1"},
+		{URLOrigin: url.URLOrigin + "z", URLShort: "batch2"},
+	}
+	created, err := st.URL().BatchCreate(ctx, batch)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{false, true}, created)
+	assert.Equal(t, url.ID, batch[0].ID)
+
+	long := model.TestURLGenerated(t)
+	long.URLOrigin += "?utm=" + strings.Repeat("x", model.DefaultMaxURLLength)
+	assert.ErrorIs(t, st.URL().Create(ctx, long), model.ErrURLTooLong)
+}
+
+func testURLCreateShortTaken(t *testing.T, st store.Store) {
+	ctx := context.Background()
+
+	url := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(ctx, url))
+
+	taken := model.TestURLGenerated(t)
+	taken.URLShort = url.URLShort
+	assert.ErrorIs(t, st.URL().Create(ctx, taken), store.ErrShortExist)
+
+	u, err := st.URL().FindByUUID(ctx, url.URLShort)
+	require.NoError(t, err)
+	assert.Equal(t, url.URLOrigin, u.URLOrigin)
+
+	// the batch fails as a whole, for a stored short code and for one
+	// repeated in the batch
+	stored := []*model.URL{model.TestURLGenerated(t), model.TestURLGenerated(t)}
+	stored[1].URLShort = url.URLShort
+	repeated := []*model.URL{model.TestURLGenerated(t), model.TestURLGenerated(t)}
+	repeated[1].URLShort = repeated[0].URLShort
+
+	for _, batch := range [][]*model.URL{stored, repeated} {
+		_, err = st.URL().BatchCreate(ctx, batch)
+		assert.ErrorIs(t, err, store.ErrShortExist)
+
+		_, err = st.URL().FindByUUID(ctx, batch[0].URLShort)
+		assert.ErrorIs(t, err, store.ErrRecordNotFound)
+	}
+}
+
+func testURLCreateDuplicate(t *testing.T, st store.Store) {
+	ctx := context.Background()
+
+	url := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(ctx, url))
+
+	dup := &model.URL{URLOrigin: url.URLOrigin, URLShort: "duplicate"}
+	assert.ErrorIs(t, st.URL().Create(ctx, dup), store.ErrURLExist)
+	assert.Equal(t, url.ID, dup.ID)
+	assert.Equal(t, url.URLShort, dup.URLShort)
+
+	_, err := st.URL().FindByUUID(ctx, "duplicate")
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+}
+
+func testURLBatchCreate(t *testing.T, st store.Store) {
+	ctx := context.Background()
+
+	existing := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(ctx, existing))
+
+	fresh := model.TestURLGenerated(t)
+	urls := []*model.URL{
+		fresh,
+		{URLOrigin: existing.URLOrigin, URLShort: "existing"},
+		{URLOrigin: fresh.URLOrigin, URLShort: "dup"},
+	}
+
+	created, err := st.URL().BatchCreate(ctx, urls)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, false, false}, created)
+	assert.Equal(t, existing.ID, urls[1].ID)
+	assert.Equal(t, existing.URLShort, urls[1].URLShort)
+	assert.Equal(t, fresh.ID, urls[2].ID)
+	assert.Equal(t, fresh.URLShort, urls[2].URLShort)
+
+	u, err := st.URL().FindByUUID(ctx, fresh.URLShort)
+	require.NoError(t, err)
+	assert.Equal(t, fresh.ID, u.ID)
+
+	invalid := model.TestURLGenerated(t)
+	_, err = st.URL().BatchCreate(ctx, []*model.URL{invalid, {URLOrigin: "http://wrong", URLShort: "wrong"}})
+	assert.Error(t, err)
+
+	_, err = st.URL().FindByUUID(ctx, invalid.URLShort)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+}
+
+func testURLOwnership(t *testing.T, st store.Store) {
+	ctx := context.Background()
+
+	user := &model.User{UUID: uuid.New().String()}
+	require.NoError(t, st.User().Create(ctx, user))
+	other := &model.User{UUID: uuid.New().String()}
+	require.NoError(t, st.User().Create(ctx, other))
+
+	var urls []*model.URL
+	for i := 0; i < 3; i++ {
+		url := model.TestURLGenerated(t)
+		require.NoError(t, st.URL().Create(ctx, url))
+		urls = append(urls, url)
+	}
+
+	// the stored record is updated, not only the struct passed in
+	for _, url := range []*model.URL{urls[2], urls[0]} {
+		v := *url
+		require.NoError(t, st.URL().UpdateUserID(ctx, &v, user.ID))
+		assert.Equal(t, user.ID, v.UserID)
+	}
+
+	u, err := st.URL().FindByID(ctx, urls[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, u.UserID)
+
+	u, err = st.URL().FindByUUID(ctx, urls[2].URLShort)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, u.UserID)
+
+	owned, err := st.URL().FindByUserID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int{urls[0].ID, urls[2].ID}, ids(owned))
+
+	owned, err = st.URL().FindByUserID(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Empty(t, owned)
+
+	missing := &model.URL{ID: urls[2].ID + 100, URLOrigin: "http://missing.ru/", URLShort: "missing"}
+	assert.ErrorIs(t, st.URL().UpdateUserID(ctx, missing, user.ID), store.ErrRecordNotFound)
+
+	_, err = st.URL().FindByID(ctx, missing.ID)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+
+	// the owner may be given to Create, the original URL stays unique
+	// across users
+	url := model.TestURLGenerated(t)
+	url.UserID = other.ID
+	require.NoError(t, st.URL().Create(ctx, url))
+
+	owned, err = st.URL().FindByUserID(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []int{url.ID}, ids(owned))
+
+	dup := model.TestURLGenerated(t)
+	dup.URLOrigin = url.URLOrigin
+	dup.UserID = user.ID
+	require.ErrorIs(t, st.URL().Create(ctx, dup), store.ErrURLExist)
+	assert.Equal(t, url.ID, dup.ID)
+}
+
+func testURLPage(t *testing.T, st store.Store) {
+	ctx := context.Background()
+
+	user := &model.User{UUID: uuid.New().String()}
+	require.NoError(t, st.User().Create(ctx, user))
+
+	var urls []*model.URL
+	for i := 0; i < 5; i++ {
+		url := model.TestURLGenerated(t)
+		require.NoError(t, st.URL().Create(ctx, url))
+		require.NoError(t, st.URL().UpdateUserID(ctx, url, user.ID))
+		urls = append(urls, url)
+	}
+	require.NoError(t, st.URL().Create(ctx, model.TestURLGenerated(t)))
+	require.NoError(t, st.URL().BatchDelete(ctx, []int{urls[1].ID}))
+
+	page, err := st.URL().FindByUserIDPage(ctx, user.ID, store.URLQuery{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, ids(urls[:2]), ids(page))
+
+	page, err = st.URL().FindByUserIDPage(ctx, user.ID, store.URLQuery{Limit: 2, After: page[1]})
+	require.NoError(t, err)
+	assert.Equal(t, ids(urls[2:4]), ids(page))
+
+	page, err = st.URL().FindByUserIDPage(ctx, user.ID, store.URLQuery{Desc: true, After: urls[2]})
+	require.NoError(t, err)
+	assert.Equal(t, []int{urls[1].ID, urls[0].ID}, ids(page))
+
+	page, err = st.URL().FindByUserIDPage(ctx, user.ID, store.URLQuery{ExcludeDeleted: true})
+	require.NoError(t, err)
+	assert.Equal(t, []int{urls[0].ID, urls[2].ID, urls[3].ID, urls[4].ID}, ids(page))
+
+	page, err = st.URL().FindByUserIDPage(ctx, user.ID, store.URLQuery{OriginContains: urls[3].URLOrigin})
+	require.NoError(t, err)
+	assert.Equal(t, []int{urls[3].ID}, ids(page))
+
+	page, err = st.URL().FindByUserIDPage(ctx, user.ID, store.URLQuery{Sort: store.SortByShort})
+	require.NoError(t, err)
+	require.Len(t, page, len(urls))
+	for i := 1; i < len(page); i++ {
+		assert.Less(t, page[i-1].URLShort, page[i].URLShort)
+	}
+
+	page, err = st.URL().FindByUserIDPage(ctx, user.ID, store.URLQuery{Sort: store.SortByShort, After: page[2]})
+	require.NoError(t, err)
+	assert.Len(t, page, 2)
+}
+
+func testURLDelete(t *testing.T, st store.Store) {
+	ctx := context.Background()
+
+	url := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(ctx, url))
+	assert.False(t, st.URL().IsDeleted(ctx, url.ID))
+
+	// the stored record is deleted, not only the struct passed in
+	v := *url
+	require.NoError(t, st.URL().Delete(ctx, &v))
+	assert.NoError(t, st.URL().Delete(ctx, &v))
+
+	assert.True(t, st.URL().IsDeleted(ctx, url.ID))
+
+	u, err := st.URL().FindByUUID(ctx, url.URLShort)
+	require.NoError(t, err)
+	assert.True(t, u.IsDeleted)
+
+	u, err = st.URL().FindByID(ctx, url.ID)
+	require.NoError(t, err)
+	assert.True(t, u.IsDeleted)
+
+	// a deleted url keeps its original URL
+	assert.ErrorIs(t, st.URL().Create(ctx, &model.URL{URLOrigin: url.URLOrigin, URLShort: "again"}), store.ErrURLExist)
+
+	missing := &model.URL{ID: url.ID + 100, URLOrigin: "http://missing.ru/", URLShort: "missing"}
+	assert.ErrorIs(t, st.URL().Delete(ctx, missing), store.ErrRecordNotFound)
+	assert.False(t, st.URL().IsDeleted(ctx, missing.ID))
+}
+
+func testURLBatchDelete(t *testing.T, st store.Store) {
+	ctx := context.Background()
+
+	var urls []*model.URL
+	for i := 0; i < 3; i++ {
+		url := model.TestURLGenerated(t)
+		require.NoError(t, st.URL().Create(ctx, url))
+		urls = append(urls, url)
+	}
+
+	require.NoError(t, st.URL().BatchDelete(ctx, nil))
+	require.NoError(t, st.URL().BatchDelete(ctx, []int{urls[0].ID, urls[2].ID, urls[2].ID + 100}))
+	require.NoError(t, st.URL().BatchDelete(ctx, []int{urls[0].ID}))
+
+	assert.True(t, st.URL().IsDeleted(ctx, urls[0].ID))
+	assert.False(t, st.URL().IsDeleted(ctx, urls[1].ID))
+	assert.True(t, st.URL().IsDeleted(ctx, urls[2].ID))
+
+	u, err := st.URL().FindByUUID(ctx, urls[2].URLShort)
+	require.NoError(t, err)
+	assert.True(t, u.IsDeleted)
+
+	_, err = st.URL().FindByID(ctx, urls[2].ID+100)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+}
+
+func testURLExpiry(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	expired := model.TestURLGenerated(t)
+	past := now.Add(-time.Hour)
+	expired.ExpiresAt = &past
+	require.NoError(t, st.URL().Create(ctx, expired))
+
+	batch := []*model.URL{model.TestURLGenerated(t), model.TestURLGenerated(t)}
+	future := now.Add(time.Hour)
+	batch[0].ExpiresAt = &future
+	_, err := st.URL().BatchCreate(ctx, batch)
+	require.NoError(t, err)
+	live := batch[0]
+
+	permanent := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(ctx, permanent))
+
+	u, err := st.URL().FindByUUID(ctx, expired.URLShort)
+	require.NoError(t, err)
+	require.NotNil(t, u.ExpiresAt)
+	assert.True(t, past.Truncate(time.Microsecond).Equal(*u.ExpiresAt))
+	assert.True(t, u.Expired(now))
+
+	u, err = st.URL().FindByID(ctx, live.ID)
+	require.NoError(t, err)
+	require.NotNil(t, u.ExpiresAt)
+	assert.True(t, future.Truncate(time.Microsecond).Equal(*u.ExpiresAt))
+	assert.False(t, u.Expired(now))
+
+	u, err = st.URL().FindByID(ctx, batch[1].ID)
+	require.NoError(t, err)
+	assert.Nil(t, u.ExpiresAt)
+
+	ids, err := st.URL().DeleteExpired(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, []int{expired.ID}, ids)
+	assert.True(t, st.URL().IsDeleted(ctx, expired.ID))
+	assert.False(t, st.URL().IsDeleted(ctx, live.ID))
+	assert.False(t, st.URL().IsDeleted(ctx, permanent.ID))
+
+	ids, err = st.URL().DeleteExpired(ctx, now)
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	ids, err = st.URL().DeleteExpired(ctx, future)
+	require.NoError(t, err)
+	assert.Equal(t, []int{live.ID}, ids)
+	assert.False(t, st.URL().IsDeleted(ctx, permanent.ID))
+}
+
+func testURLPurge(t *testing.T, st store.Store) {
+	ctx := context.Background()
+	start := time.Now()
+
+	urls := []*model.URL{model.TestURLGenerated(t), model.TestURLGenerated(t), model.TestURLGenerated(t)}
+	_, err := st.URL().BatchCreate(ctx, urls)
+	require.NoError(t, err)
+	first, second, live := urls[0], urls[1], urls[2]
+
+	require.NoError(t, st.URL().Delete(ctx, first))
+	u, err := st.URL().FindByID(ctx, first.ID)
+	require.NoError(t, err)
+	require.NotNil(t, u.DeletedAt)
+	assert.False(t, u.DeletedAt.Before(start.Truncate(time.Microsecond)))
+	deletedAt := *u.DeletedAt
+
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, st.URL().BatchDelete(ctx, []int{second.ID}))
+
+	ids, err := st.URL().PurgeDeleted(ctx, start.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	ids, err = st.URL().PurgeDeleted(ctx, deletedAt)
+	require.NoError(t, err)
+	assert.Equal(t, []int{first.ID}, ids)
+
+	_, err = st.URL().FindByID(ctx, first.ID)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+	_, err = st.URL().FindByUUID(ctx, first.URLShort)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+	assert.False(t, st.URL().IsDeleted(ctx, first.ID))
+
+	// a rolled back purge leaves the url there
+	errRollback := errors.New("rollback")
+	err = st.WithTx(ctx, func(tx store.Store) error {
+		if err := tx.URL().Purge(ctx, []int{second.ID}); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+	assert.True(t, st.URL().IsDeleted(ctx, second.ID))
+
+	require.NoError(t, st.URL().Purge(ctx, []int{second.ID, live.ID}))
+	_, err = st.URL().FindByUUID(ctx, second.URLShort)
+	assert.ErrorIs(t, err, store.ErrRecordNotFound)
+	u, err = st.URL().FindByID(ctx, live.ID)
+	require.NoError(t, err)
+	assert.Equal(t, live.URLShort, u.URLShort)
+
+	// the original url can be shortened again and gets a new ID
+	again := model.TestURLGenerated(t)
+	again.URLOrigin = first.URLOrigin
+	require.NoError(t, st.URL().Create(ctx, again))
+	assert.Greater(t, again.ID, live.ID)
+
+	u, err = st.URL().FindByUUID(ctx, again.URLShort)
+	require.NoError(t, err)
+	assert.Equal(t, again.ID, u.ID)
+	assert.False(t, u.IsDeleted)
+	assert.Nil(t, u.DeletedAt)
+}
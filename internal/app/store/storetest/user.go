@@ -0,0 +1,42 @@
+package storetest
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func testUser(t *testing.T, st store.Store) {
+	ctx := context.Background()
+
+	user := &model.User{UUID: uuid.New().String()}
+	require.NoError(t, st.User().Create(ctx, user))
+	assert.NotZero(t, user.ID)
+
+	// creating a known uuid again returns the existing user
+	again := &model.User{UUID: user.UUID}
+	require.NoError(t, st.User().Create(ctx, again))
+	assert.Equal(t, user.ID, again.ID)
+
+	other := &model.User{UUID: uuid.New().String()}
+	require.NoError(t, st.User().Create(ctx, other))
+	assert.NotEqual(t, user.ID, other.ID)
+
+	u, err := st.User().FindByUUID(ctx, user.UUID)
+	require.NoError(t, err)
+	assert.Equal(t, *user, *u)
+
+	u, err = st.User().FindByID(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, *other, *u)
+
+	_, err = st.User().FindByUUID(ctx, uuid.New().String())
+	assert.ErrorIs(t, err, store.ErrUserNotFound)
+
+	_, err = st.User().FindByID(ctx, other.ID+100)
+	assert.ErrorIs(t, err, store.ErrUserNotFound)
+}
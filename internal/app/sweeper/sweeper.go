@@ -0,0 +1,95 @@
+// Package sweeper marks expired links as deleted in the background and,
+// once they have been deleted for long enough, removes them for good.
+package sweeper
+
+import (
+	"context"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"log"
+	"time"
+)
+
+type Sweeper struct {
+	store     store.Store
+	interval  time.Duration
+	retention time.Duration
+}
+
+type Option func(*Sweeper)
+
+// WithRetention makes every sweep also purge the links which have been
+// deleted for longer than d. Deleted links are kept by default.
+func WithRetention(d time.Duration) Option {
+	return func(s *Sweeper) {
+		s.retention = d
+	}
+}
+
+func New(st store.Store, interval time.Duration, opts ...Option) *Sweeper {
+	s := &Sweeper{
+		store:    st,
+		interval: interval,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Run sweeps every interval until ctx is done. A failed sweep is logged and
+// tried again on the next tick.
+func (s *Sweeper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			n, err := s.Sweep(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Println("sweeper:", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("sweeper: %d expired links deleted", n)
+			}
+
+			if s.retention <= 0 {
+				continue
+			}
+			n, err = s.Purge(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Println("sweeper:", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("sweeper: %d deleted links purged", n)
+			}
+		}
+	}
+}
+
+// Sweep deletes the links which have expired by now and returns how many
+// there were.
+func (s *Sweeper) Sweep(ctx context.Context) (int, error) {
+	ids, err := s.store.URL().DeleteExpired(ctx, time.Now())
+
+	return len(ids), err
+}
+
+// Purge removes the links which have been deleted for longer than the
+// retention and returns how many there were. It does nothing without
+// WithRetention.
+func (s *Sweeper) Purge(ctx context.Context) (int, error) {
+	if s.retention <= 0 {
+		return 0, nil
+	}
+
+	ids, err := s.store.URL().PurgeDeleted(ctx, time.Now().Add(-s.retention))
+
+	return len(ids), err
+}
@@ -0,0 +1,92 @@
+package sweeper_test
+
+import (
+	"context"
+	"errors"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/model"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/store/memstore"
+	"github.com/iryzzh/practicum-go-shortener/internal/app/sweeper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSweeper(t *testing.T) {
+	st := memstore.New()
+	ctx := context.Background()
+
+	expired := model.TestURLGenerated(t)
+	past := time.Now().Add(-time.Second)
+	expired.ExpiresAt = &past
+	require.NoError(t, st.URL().Create(ctx, expired))
+
+	soon := model.TestURLGenerated(t)
+	later := time.Now().Add(50 * time.Millisecond)
+	soon.ExpiresAt = &later
+	require.NoError(t, st.URL().Create(ctx, soon))
+
+	permanent := model.TestURLGenerated(t)
+	require.NoError(t, st.URL().Create(ctx, permanent))
+
+	sw := sweeper.New(st, 10*time.Millisecond)
+
+	n, err := sw.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.True(t, st.URL().IsDeleted(ctx, expired.ID))
+	assert.False(t, st.URL().IsDeleted(ctx, soon.ID))
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		done <- sw.Run(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return st.URL().IsDeleted(ctx, soon.ID)
+	}, time.Second, 10*time.Millisecond)
+	assert.False(t, st.URL().IsDeleted(ctx, permanent.ID))
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestSweeperPurge(t *testing.T) {
+	st := memstore.New()
+	ctx := context.Background()
+
+	urls := []*model.URL{model.TestURLGenerated(t), model.TestURLGenerated(t)}
+	_, err := st.URL().BatchCreate(ctx, urls)
+	require.NoError(t, err)
+	require.NoError(t, st.URL().Delete(ctx, urls[0]))
+
+	n, err := sweeper.New(st, time.Hour).Purge(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	sw := sweeper.New(st, 10*time.Millisecond, sweeper.WithRetention(30*time.Millisecond))
+
+	n, err = sw.Purge(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.True(t, st.URL().IsDeleted(ctx, urls[0].ID))
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		done <- sw.Run(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		_, err := st.URL().FindByID(ctx, urls[0].ID)
+		return errors.Is(err, store.ErrRecordNotFound)
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = st.URL().FindByID(ctx, urls[1].ID)
+	assert.NoError(t, err)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -66,6 +66,12 @@ func RandString(n int) string {
 	return randStringBytesMaskImprSrcUnsafe(n, letterBytes)
 }
 
+// RandStringFrom makes a random string of the characters of set, which has
+// to have at most 64 of them.
+func RandStringFrom(n int, set string) string {
+	return randStringBytesMaskImprSrcUnsafe(n, set)
+}
+
 func RandStringLowerCase(n int) string {
 	return randStringBytesMaskImprSrcUnsafe(n, letterBytesStringOnly)
 }